@@ -0,0 +1,219 @@
+package main
+
+// оценка точности классификации закрытых лотов (closeEntry) по "правде"
+// от симулятора или ручной разметке:
+//
+//   auc-eval -truth data/sim/eu-simulated-truth.json \
+//       -meta 'data/result/*eu-simulated-metadata' \
+//       -auctions 'data/result/*eu-simulated-auctions'
+//
+// печатает матрицу ошибок, точность/полноту по классам и разбивку
+// по последнему увиденному timeLeft
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	parser "github.com/gourytch/gowowuction/parser"
+	simulator "github.com/gourytch/gowowuction/simulator"
+)
+
+const (
+	UNKNOWN  = "unknown"  // закрыт во время пропуска снимков
+	UNCLOSED = "unclosed" // процессор лот так и не закрыл
+)
+
+var predicted = []string{simulator.R_BOUGHT, simulator.R_AUCTIONED, simulator.R_EXPIRED, UNKNOWN, UNCLOSED}
+var actual = []string{simulator.R_BOUGHT, simulator.R_AUCTIONED, simulator.R_EXPIRED,
+	simulator.R_CANCELLED, simulator.R_OPEN}
+var buckets = []string{parser.S_SHORT, parser.S_MEDIUM, parser.S_LONG, parser.S_VERY_LONG, "?"}
+
+func sold(result string) bool {
+	return result == simulator.R_BOUGHT || result == simulator.R_AUCTIONED
+}
+
+// прочитать JSON-строки из всех файлов по маске в fn
+func readLines(mask string, fn func(line []byte) error) (files int, err error) {
+	fnames, err := filepath.Glob(mask)
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(fnames)
+	for _, fname := range fnames {
+		f, err := os.Open(fname)
+		if err != nil {
+			return files, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 1<<16), 1<<24)
+		for scanner.Scan() {
+			if err = fn(scanner.Bytes()); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = scanner.Err()
+		}
+		f.Close()
+		if err != nil {
+			return files, fmt.Errorf("%s: %s", fname, err)
+		}
+		files++
+	}
+	return files, nil
+}
+
+type matrix map[string]map[string]int
+
+func (m matrix) add(truth, pred string) {
+	if m[truth] == nil {
+		m[truth] = make(map[string]int)
+	}
+	m[truth][pred]++
+}
+
+func pct(a, b int) string {
+	if b == 0 {
+		return "    -"
+	}
+	return fmt.Sprintf("%4.1f%%", float64(a)*100/float64(b))
+}
+
+func main() {
+	truth_fname := flag.String("truth", "", "ground truth file (JSON lines of simulator.Truth)")
+	meta_mask := flag.String("meta", "", "processor metadata files (glob)")
+	auc_mask := flag.String("auctions", "", "processor auctions files (glob), for timeLeft breakdown")
+	flag.Parse()
+	if *truth_fname == "" || *meta_mask == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	truth, err := simulator.LoadTruth(*truth_fname)
+	if err != nil {
+		log.Fatalf("truth load error: %s", err)
+	}
+	log.Printf("%d labelled auctions in %s", len(truth), *truth_fname)
+
+	result := make(map[int64]string)
+	n, err := readLines(*meta_mask, func(line []byte) error {
+		var m parser.AuctionMeta
+		if err := json.Unmarshal(line, &m); err != nil {
+			return err
+		}
+		result[m.Auc] = m.Result
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("metadata load error: %s", err)
+	}
+	log.Printf("%d closed auctions in %d metadata files", len(result), n)
+
+	timeleft := make(map[int64]string)
+	if *auc_mask != "" {
+		n, err = readLines(*auc_mask, func(line []byte) error {
+			var a parser.Auction
+			if err := json.Unmarshal(line, &a); err != nil {
+				return err
+			}
+			timeleft[a.Auc] = a.TimeLeft
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("auctions load error: %s", err)
+		}
+		log.Printf("%d closed auctions in %d auctions files", len(timeleft), n)
+	}
+
+	total := make(matrix)
+	bybucket := make(map[string]matrix)
+	for auc, t := range truth {
+		pred, closed := result[auc]
+		if !closed {
+			if t.Result == simulator.R_OPEN {
+				continue // обе стороны согласны, что лот ещё жив
+			}
+			pred = UNCLOSED
+		}
+		total.add(t.Result, pred)
+		if closed {
+			bucket, ok := timeleft[auc]
+			if !ok {
+				bucket = "?"
+			}
+			if bybucket[bucket] == nil {
+				bybucket[bucket] = make(matrix)
+			}
+			bybucket[bucket].add(t.Result, pred)
+		}
+	}
+	unknown := 0
+	for auc := range result {
+		if _, ok := truth[auc]; !ok {
+			unknown++
+		}
+	}
+	if unknown > 0 {
+		log.Printf("%d closed auctions have no ground truth, ignored", unknown)
+	}
+
+	fmt.Printf("\nconfusion matrix (rows: truth, columns: predicted)\n")
+	fmt.Printf("%-10s", "")
+	for _, p := range predicted {
+		fmt.Printf(" %10s", p)
+	}
+	fmt.Printf(" %10s\n", "total")
+	for _, a := range actual {
+		row := 0
+		fmt.Printf("%-10s", a)
+		for _, p := range predicted {
+			fmt.Printf(" %10d", total[a][p])
+			row += total[a][p]
+		}
+		fmt.Printf(" %10d\n", row)
+	}
+
+	fmt.Printf("\n%-10s %9s %9s\n", "class", "precision", "recall")
+	for _, c := range predicted[:3] {
+		tp, col, row := total[c][c], 0, 0
+		for _, a := range actual {
+			col += total[a][c]
+		}
+		for _, p := range predicted {
+			row += total[c][p]
+		}
+		fmt.Printf("%-10s %9s %9s\n", c, pct(tp, col), pct(tp, row))
+	}
+
+	fmt.Printf("\nby last seen timeLeft (closed auctions only)\n")
+	fmt.Printf("%-10s %8s %9s %9s   %s\n", "timeLeft", "count", "accuracy", "sold ok", "truth distribution")
+	for _, b := range buckets {
+		m := bybucket[b]
+		if m == nil {
+			continue
+		}
+		count, correct, soldok := 0, 0, 0
+		dist := ""
+		for _, a := range actual {
+			row := 0
+			for _, p := range predicted {
+				row += m[a][p]
+				if sold(a) == sold(p) {
+					soldok += m[a][p]
+				}
+			}
+			correct += m[a][a]
+			count += row
+			if row > 0 {
+				dist += fmt.Sprintf(" %s:%d", a, row)
+			}
+		}
+		fmt.Printf("%-10s %8d %9s %9s  %s\n", b, count, pct(correct, count), pct(soldok, count), dist)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+// поддельный Battle.net API на фикстурах.
+//
+//   auc-mock -dir fixtures -listen 127.0.0.1:8080
+//       просто отдавать фикстуры (api_base_url: "http://127.0.0.1:8080")
+//   auc-mock -dir fixtures -e2e legacy|modern
+//       прогнать fetch -> parse во временном каталоге по всем снимкам
+//       из фикстур и выйти с ненулевым кодом при любой ошибке
+//       (в CI то же самое делает go test ./mockapi)
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	config "github.com/gourytch/gowowuction/config"
+	fetcher "github.com/gourytch/gowowuction/fetcher"
+	mockapi "github.com/gourytch/gowowuction/mockapi"
+	parser "github.com/gourytch/gowowuction/parser"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+func runE2E(m *mockapi.Server, mode string, workdir string) (errors int) {
+	cf := config.Default(workdir)
+	cf.APIMode = mode
+	cf.APIKey = "mock"
+	cf.ClientID = "mock"
+	cf.ClientSecret = "mock"
+	cf.APIBaseURL = m.URL
+	cf.LocalesList = []string{"en_US"}
+	cf.RetryBaseDelay = "10ms"
+	cf.RetryMaxDelay = "100ms"
+	cf.FetchRateLimit = 0
+	cf.RealmsList = nil
+	for _, realm := range m.Realms() {
+		if util.IsCommoditiesRealm(realm) {
+			cf.FetchCommodities = mode == config.API_MODERN
+		} else {
+			cf.RealmsList = append(cf.RealmsList, realm)
+		}
+	}
+	cf.Dump()
+	util.CheckDir(cf.DownloadDirectory)
+	util.CheckDir(cf.TempDirectory)
+	util.CheckDir(cf.ResultDirectory)
+
+	s := &fetcher.Session{Config: cf}
+	for step := 0; step < m.Steps(); step++ {
+		log.Printf("=== E2E FETCH STEP %d ===", step)
+		targets, failed := s.Targets()
+		errors += len(failed)
+		for _, r := range s.FetchAll(targets, cf.LocalesList, cf.FetchConcurrency) {
+			if r.Err != nil {
+				log.Printf("%s/%s: FAILED: %s", r.Realm, r.Locale, r.Err)
+				errors++
+			}
+		}
+		m.Step()
+	}
+
+	log.Println("=== E2E PARSE ===")
+	for _, realm := range s.SnapshotNames() {
+		parser.ParseDir(cf, realm, false)
+	}
+
+	snapshots, _ := filepath.Glob(cf.DownloadDirectory + "*.json.gz")
+	results, _ := filepath.Glob(cf.ResultDirectory + "*")
+	log.Printf("downloaded %d snapshots, produced %d result files", len(snapshots), len(results))
+	if len(snapshots) == 0 || len(results) == 0 {
+		errors++
+	}
+	return errors
+}
+
+func main() {
+	var opt mockapi.Options
+	listen := flag.String("listen", "", "serve at host:port")
+	e2e := flag.String("e2e", "", "run fetch->parse end to end in api mode legacy|modern")
+	keep := flag.Bool("keep", false, "keep e2e working directory")
+	flag.StringVar(&opt.Dir, "dir", filepath.Join(util.AppDir(), "fixtures"), "fixtures directory")
+	flag.DurationVar(&opt.Latency, "latency", 0, "delay before each response")
+	flag.IntVar(&opt.FailEvery, "fail-every", 0, "fail every Nth request")
+	flag.IntVar(&opt.FailCode, "fail-code", http.StatusServiceUnavailable, "status code for failed requests")
+	flag.BoolVar(&opt.Gzip, "gzip", false, "send gzip-encoded responses")
+	flag.BoolVar(&opt.Conditional, "conditional", true, "answer 304 to conditional requests")
+	flag.Parse()
+
+	m, err := mockapi.New(opt)
+	if err != nil {
+		log.Fatalln("mockapi: ", err)
+	}
+	switch {
+	case *e2e != "":
+		workdir, err := ioutil.TempDir("", "auc-mock-")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !*keep {
+			defer os.RemoveAll(workdir)
+		}
+		m.Start()
+		errors := runE2E(m, *e2e, workdir)
+		m.Close()
+		log.Printf("e2e in %s: %d errors", workdir, errors)
+		if errors > 0 {
+			if !*keep {
+				os.RemoveAll(workdir)
+			}
+			os.Exit(1)
+		}
+	case *listen != "":
+		m.URL = "http://" + *listen
+		log.Printf("mockapi: listening at %s", m.URL)
+		log.Fatal(http.ListenAndServe(*listen, m))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+// генератор серии снимков с известным исходом каждого лота:
+//
+//   auc-sim -out data/sim/ -realm eu:simulated -hours 72
+//
+// пишет realm-YYYYMMDD_HHMMSS.json.gz и realm-truth.json (по строке на лот)
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	simulator "github.com/gourytch/gowowuction/simulator"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+func main() {
+	p := simulator.DefaultParams()
+	outdir := flag.String("out", "data/sim/", "output directory")
+	hours := flag.Float64("hours", p.Duration.Hours(), "simulated time span, hours")
+	start := flag.String("start", util.TSStr(p.Start), "first snapshot time, YYYYMMDD_HHMMSS (UTC)")
+	flag.StringVar(&p.Realm, "realm", p.Realm, "realm name, region:slug")
+	flag.DurationVar(&p.Interval, "interval", p.Interval, "time between snapshots")
+	flag.DurationVar(&p.Jitter, "jitter", p.Jitter, "random delay of each snapshot")
+	flag.IntVar(&p.Sellers, "sellers", p.Sellers, "number of sellers")
+	flag.IntVar(&p.Items, "items", p.Items, "number of distinct items")
+	flag.Float64Var(&p.PostRate, "post-rate", p.PostRate, "new auctions per hour")
+	flag.Float64Var(&p.BuyoutRate, "buyout-rate", p.BuyoutRate, "buyout intensity per auction per hour")
+	flag.Float64Var(&p.BidRate, "bid-rate", p.BidRate, "bid intensity per auction per hour")
+	flag.Float64Var(&p.CancelRate, "cancel-rate", p.CancelRate, "cancel intensity per auction per hour")
+	flag.Float64Var(&p.NoBuyoutPct, "no-buyout", p.NoBuyoutPct, "share of auctions without buyout")
+	flag.Int64Var(&p.Seed, "seed", p.Seed, "random seed")
+	flag.Parse()
+
+	var err error
+	if p.Start, err = util.ParseTS(*start); err != nil {
+		log.Fatalf("bad start time '%s': %s", *start, err)
+	}
+	p.Duration = time.Duration(*hours * float64(time.Hour))
+	if !strings.HasSuffix(*outdir, "/") {
+		*outdir += "/"
+	}
+	util.CheckDir(*outdir)
+	truth, err := simulator.New(p).Run(*outdir)
+	if err != nil {
+		log.Fatalln("simulation failed: ", err)
+	}
+	log.Printf("ground truth stored to %s", truth)
+}
@@ -42,7 +42,7 @@ func MakeTarball(tarname string, fnames []string) error {
 	defer tarwriter.Close()
 
 	for _, fname := range fnames {
-		realm, ts, good := util.Parse_FName(fname)
+		realm, ts, good := util.Parse_AnyFName(fname)
 		if !good {
 			log.Printf("warning: skip ill-named file '%s'", fname)
 			continue // skip
@@ -82,7 +82,7 @@ func MakeZip(zipname string, fnames []string) error {
 	defer zipwriter.Close()
 
 	for _, fname := range fnames {
-		realm, ts, good := util.Parse_FName(fname)
+		realm, ts, good := util.Parse_AnyFName(fname)
 		if !good {
 			log.Printf("warning: skip ill-named file '%s'", fname)
 			continue // skip
@@ -118,11 +118,16 @@ func Backup(srcdir, dstdir, timeformat, ext string) {
 
 	for _, fname := range fnames {
 		// realm, ts, good := util.Parse_FName(fname)
-		realm, ts, good := util.Parse_FName(fname)
+		realm, ts, good := util.Parse_AnyFName(fname)
 		if good {
 			// log.Printf("fname %s -> %s, %v", fname, realm, ts)
 			key := strings.Replace(realm, ":", "-", -1) + "-" + ts.Format(timeformat)
 			rmap[key] = append(rmap[key], fname)
+			// метаданные снимка общего аукциона - в тот же архив
+			meta := filepath.Join(filepath.Dir(fname), util.Make_MetaFName(realm, ts))
+			if util.CheckFile(meta) {
+				rmap[key] = append(rmap[key], meta)
+			}
 		} else {
 			// log.Printf("skip fname %s", fname)
 		}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"path/filepath"
@@ -14,8 +15,23 @@ import (
 
 const SLASH = filepath.Separator
 
+const (
+	API_LEGACY = "legacy" // api.battle.net с apikey (Mashery)
+	API_MODERN = "modern" // api.blizzard.com с OAuth2
+)
+
+const (
+	STATE_JSON   = "json"   // {realm}-state.gz, gzip-нутый JSON
+	STATE_BINARY = "binary" // {realm}-state.bin, см. parser/state.go
+)
+
 type Config struct {
 	APIKey            string   `json:"apikey"`
+	APIMode           string   `json:"api_mode"`
+	ClientID          string   `json:"client_id"`
+	ClientSecret      string   `json:"client_secret"`
+	APIBaseURL        string   `json:"api_base_url"` // "" = real Blizzard servers
+	FetchCommodities  bool     `json:"commodities"`
 	RealmsList        []string `json:"realms"`
 	LocalesList       []string `json:"locales"`
 	DownloadDirectory string   `json:"download_dir"`
@@ -23,11 +39,30 @@ type Config struct {
 	ResultDirectory   string   `json:"result_dir"`
 	NameFormat        string   `json:"name_format"`
 	TimedNameFormat   string   `json:"timed_name_format"`
+	RetryAttempts     int      `json:"retry_attempts"`
+	RetryBaseDelay    string   `json:"retry_base_delay"`
+	RetryMaxDelay     string   `json:"retry_max_delay"`
+	RetryStatusCodes  []int    `json:"retry_status_codes"`
+	FetchConcurrency  int      `json:"fetch_concurrency"`
+	FetchRateLimit    float64  `json:"fetch_rate_limit"` // requests per second, 0 = unlimited
+	DaemonFetch       string   `json:"daemon_fetch"`     // cron-like schedule, "" = never
+	DaemonParse       string   `json:"daemon_parse"`
+	DaemonBackup      string   `json:"daemon_backup"`
+	LockFile          string   `json:"lock_file"`
+	GapThreshold      string   `json:"gap_threshold"`      // longer pause between snapshots is a gap
+	ParseConcurrency  int      `json:"parse_concurrency"`  // realms parsed at once
+	StateFormat       string   `json:"state_format"`       // json | binary
+	MarketWindowDays  int      `json:"market_window_days"` // market value smoothing window
+	ReportDays        int      `json:"report_days"`        // sales and seller period
 }
 
 func defaultConfig() *Config {
 	cf := new(Config)
 	cf.APIKey = ""
+	cf.APIMode = API_LEGACY
+	cf.ClientID = ""
+	cf.ClientSecret = ""
+	cf.FetchCommodities = false
 	cf.RealmsList = []string{"eu:fordragon"}
 	cf.LocalesList = []string{"en_US", "ru_RU"}
 	cf.DownloadDirectory = "data/download"
@@ -35,11 +70,42 @@ func defaultConfig() *Config {
 	cf.ResultDirectory = "data/result"
 	cf.NameFormat = "{realm}-{name}"
 	cf.TimedNameFormat = "2006_01-{realm}-{name}" // split by month
+	cf.RetryAttempts = 5
+	cf.RetryBaseDelay = "2s"
+	cf.RetryMaxDelay = "2m"
+	cf.RetryStatusCodes = []int{429, 500, 502, 503, 504}
+	cf.FetchConcurrency = 4
+	cf.FetchRateLimit = 10
+	cf.DaemonFetch = "*/10 * * * *"
+	cf.DaemonParse = "5 * * * *"
+	cf.DaemonBackup = "30 3 * * *"
+	cf.LockFile = "gowowuction.lock" // in TempDirectory
+	cf.GapThreshold = "3h"
+	cf.ParseConcurrency = 2
+	cf.StateFormat = STATE_JSON
+	cf.MarketWindowDays = 14
+	cf.ReportDays = 7
+	return cf
+}
+
+// конфиг по умолчанию с каталогами относительно basedir
+func Default(basedir string) *Config {
+	cf := defaultConfig()
+	basedir, _ = filepath.Abs(basedir)
+	basedir = basedir + string(SLASH)
+	cf.DownloadDirectory = fixD("", cf.DownloadDirectory, basedir)
+	cf.TempDirectory = fixD("", cf.TempDirectory, basedir)
+	cf.ResultDirectory = fixD("", cf.ResultDirectory, basedir)
+	cf.LockFile = fixF("", cf.LockFile, cf.TempDirectory)
 	return cf
 }
 
 func (cf *Config) Dump() {
 	log.Println("APIKey: ", cf.APIKey)
+	log.Println("APIMode: ", cf.APIMode)
+	log.Println("ClientID: ", cf.ClientID)
+	log.Println("APIBaseURL: ", cf.APIBaseURL)
+	log.Println("FetchCommodities: ", cf.FetchCommodities)
 	log.Println("RealmsList: ", cf.RealmsList)
 	log.Println("LocalesList: ", cf.LocalesList)
 	log.Println("DownloadDirectory: ", cf.DownloadDirectory)
@@ -47,6 +113,34 @@ func (cf *Config) Dump() {
 	log.Println("ResultDirectory: ", cf.ResultDirectory)
 	log.Println("NameFormat:", cf.NameFormat)
 	log.Println("TimedNameFormat:", cf.TimedNameFormat)
+	log.Println("RetryAttempts:", cf.RetryAttempts)
+	log.Println("RetryBaseDelay:", cf.RetryBaseDelay)
+	log.Println("RetryMaxDelay:", cf.RetryMaxDelay)
+	log.Println("RetryStatusCodes:", cf.RetryStatusCodes)
+	log.Println("FetchConcurrency:", cf.FetchConcurrency)
+	log.Println("FetchRateLimit:", cf.FetchRateLimit)
+	log.Println("DaemonFetch:", cf.DaemonFetch)
+	log.Println("DaemonParse:", cf.DaemonParse)
+	log.Println("DaemonBackup:", cf.DaemonBackup)
+	log.Println("LockFile:", cf.LockFile)
+	log.Println("GapThreshold:", cf.GapThreshold)
+	log.Println("ParseConcurrency:", cf.ParseConcurrency)
+	log.Println("StateFormat:", cf.StateFormat)
+	log.Println("MarketWindowDays:", cf.MarketWindowDays)
+	log.Println("ReportDays:", cf.ReportDays)
+}
+
+// регионы из списка реалмов, без повторов, в порядке упоминания
+func (cf *Config) Regions() (regions []string) {
+	seen := make(map[string]bool)
+	for _, realm := range cf.RealmsList {
+		region := strings.Split(realm, ":")[0]
+		if !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	return regions
 }
 
 func (cf *Config) GetTimedName(name string, realm string, ts time.Time) string {
@@ -100,12 +194,73 @@ func load(fname string) (*Config, error) {
 	cf.DownloadDirectory = fixD(cf.DownloadDirectory, dflt.DownloadDirectory, basedir)
 	cf.TempDirectory = fixD(cf.TempDirectory, dflt.TempDirectory, basedir)
 	cf.ResultDirectory = fixD(cf.ResultDirectory, dflt.ResultDirectory, basedir)
+	switch cf.APIMode {
+	case "":
+		cf.APIMode = dflt.APIMode
+	case API_LEGACY, API_MODERN:
+	default:
+		return nil, fmt.Errorf("unknown api_mode '%s'", cf.APIMode)
+	}
+	if cf.FetchCommodities && cf.APIMode != API_MODERN {
+		return nil, fmt.Errorf("commodities are available only with api_mode '%s'", API_MODERN)
+	}
 	if cf.NameFormat == "" {
 		cf.NameFormat = dflt.NameFormat
 	}
 	if cf.TimedNameFormat == "" {
 		cf.TimedNameFormat = dflt.TimedNameFormat
 	}
+	if cf.RetryAttempts <= 0 {
+		cf.RetryAttempts = dflt.RetryAttempts
+	}
+	if cf.RetryBaseDelay == "" {
+		cf.RetryBaseDelay = dflt.RetryBaseDelay
+	}
+	if cf.RetryMaxDelay == "" {
+		cf.RetryMaxDelay = dflt.RetryMaxDelay
+	}
+	if cf.RetryStatusCodes == nil {
+		cf.RetryStatusCodes = dflt.RetryStatusCodes
+	}
+	if cf.FetchConcurrency <= 0 {
+		cf.FetchConcurrency = dflt.FetchConcurrency
+	}
+	if cf.FetchRateLimit < 0 {
+		cf.FetchRateLimit = 0
+	}
+	if cf.GapThreshold == "" {
+		cf.GapThreshold = dflt.GapThreshold
+	}
+	if cf.ParseConcurrency <= 0 {
+		cf.ParseConcurrency = dflt.ParseConcurrency
+	}
+	if cf.MarketWindowDays <= 0 {
+		cf.MarketWindowDays = dflt.MarketWindowDays
+	}
+	if cf.ReportDays <= 0 {
+		cf.ReportDays = dflt.ReportDays
+	}
+	switch cf.StateFormat {
+	case "":
+		cf.StateFormat = dflt.StateFormat
+	case STATE_JSON, STATE_BINARY:
+	default:
+		return nil, fmt.Errorf("unknown state_format '%s'", cf.StateFormat)
+	}
+	// расписания демона: пустое значение в конфиге отключает задачу,
+	// отсутствие ключа - значение по умолчанию
+	var present map[string]*json.RawMessage
+	json.Unmarshal(data, &present)
+	if _, ok := present["daemon_fetch"]; !ok {
+		cf.DaemonFetch = dflt.DaemonFetch
+	}
+	if _, ok := present["daemon_parse"]; !ok {
+		cf.DaemonParse = dflt.DaemonParse
+	}
+	if _, ok := present["daemon_backup"]; !ok {
+		cf.DaemonBackup = dflt.DaemonBackup
+	}
+	cf.LockFile = fixF(cf.LockFile, dflt.LockFile, cf.TempDirectory)
 
 	cf.Dump()
 	return cf, nil
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+	schedule "github.com/gourytch/gowowuction/schedule"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type daemonJob struct {
+	name  string
+	sched *schedule.Schedule
+	next  time.Time
+	run   func(cf *config.Config)
+}
+
+// крутиться до SIGTERM/SIGINT, запуская fetch, parse и backup по расписанию
+// из конфига. задачи выполняются по очереди в одном потоке, так что они
+// не пересекаются; по сигналу текущая задача доводится до ближайшего
+// целого снимка, после чего демон выходит
+func DoDaemon(cf *config.Config) {
+	log.Println("=== DAEMON BEGIN ===")
+	var jobs []*daemonJob
+	add := func(name string, expr string, run func(cf *config.Config)) {
+		if expr == "" {
+			log.Printf("%s: not scheduled", name)
+			return
+		}
+		sched, err := schedule.Parse(expr)
+		if err != nil {
+			log.Fatalf("%s: %s", name, err)
+		}
+		jobs = append(jobs, &daemonJob{name: name, sched: sched, run: run})
+	}
+	add("fetch", cf.DaemonFetch, func(cf *config.Config) { DoFetch(cf) })
+	add("parse", cf.DaemonParse, DoParse)
+	add("backup", cf.DaemonBackup, DoBackup)
+	if len(jobs) == 0 {
+		log.Println("nothing to schedule")
+		return
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Printf("got %s, finishing current job ...", sig)
+		util.RequestStop()
+		close(stop)
+	}()
+
+	now := time.Now()
+	for _, job := range jobs {
+		job.next = job.sched.Next(now)
+		log.Printf("%s: scheduled '%s', first run at %s", job.name, job.sched.Expr, job.next)
+	}
+	for !util.StopRequested() {
+		var nearest time.Time
+		for _, job := range jobs {
+			if !job.next.IsZero() && (nearest.IsZero() || job.next.Before(nearest)) {
+				nearest = job.next
+			}
+		}
+		if nearest.IsZero() {
+			log.Println("no more runs scheduled")
+			break
+		}
+		timer := time.NewTimer(nearest.Sub(time.Now()))
+		select {
+		case <-stop:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+		for _, job := range jobs { // fetch, parse, backup - в этом порядке
+			if util.StopRequested() || time.Now().Before(job.next) {
+				continue
+			}
+			log.Printf("%s: run scheduled at %s", job.name, job.next)
+			job.run(cf)
+			job.next = job.sched.Next(time.Now())
+			log.Printf("%s: next run at %s", job.name, job.next)
+		}
+	}
+	log.Println("=== DAEMON END ===")
+}
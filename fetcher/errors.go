@@ -0,0 +1,57 @@
+package fetcher
+
+import (
+	"fmt"
+	"time"
+)
+
+// сетевой сбой: запрос не выполнен или тело не дочитано
+type RequestError struct {
+	Url string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("request %s failed: %s", e.Url, e.Err)
+}
+
+// сервер ответил кодом, отличным от 200
+type HTTPError struct {
+	Url        string
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // из заголовка Retry-After, если был
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("request %s failed: HTTP %s", e.Url, e.Status)
+}
+
+// ответ получен, но не распакован (Stage="gzip") или не разобран (Stage="json")
+type DecodeError struct {
+	Url   string
+	Stage string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s decode of %s failed: %s", e.Stage, e.Url, e.Err)
+}
+
+// метаинформация разобрана, но список файлов пуст
+type NoFilesError struct {
+	Url string
+}
+
+func (e *NoFilesError) Error() string {
+	return fmt.Sprintf("no files listed in %s", e.Url)
+}
+
+// сервер ответил 304: с прошлого раза ничего не поменялось
+type NotModifiedError struct {
+	Url string
+}
+
+func (e *NotModifiedError) Error() string {
+	return fmt.Sprintf("%s not modified", e.Url)
+}
@@ -9,10 +9,13 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
 )
 
 type FDesc struct {
@@ -25,60 +28,336 @@ type Rec1 struct {
 }
 
 type Session struct {
-	Config *config.Config
-	Client *http.Client
+	Config  *config.Config
+	Client  *http.Client
+	Retry   *RetryPolicy
+	Limiter *RateLimiter
+	BaseURL string // если задан - вместо api_base_url из конфига
+
+	lock      sync.Mutex
+	tokenLock sync.Mutex        // только для tokens
+	tokens    map[string]*Token // region -> oauth2 token
+	resolver  *RealmResolver
+	state     *FetchState
+}
+
+// GET с повторами согласно RetryPolicy. realm нужен только для логов
+func (s *Session) Get(realm string, url string) (body []byte, err error) {
+	body, _, err = s.GetWithHeader(realm, url, nil)
+	return body, err
+}
+
+// то же, что Get, но с дополнительными заголовками запроса.
+// возвращает ещё и заголовки ответа
+func (s *Session) GetWithHeader(realm string, url string, header http.Header) (body []byte, rheader http.Header, err error) {
+	rheader, err = s.retry(realm, url, func() (h http.Header, e error) {
+		body, h, e = s.getOnce(url, header)
+		return h, e
+	})
+	if err != nil {
+		body = nil
+	}
+	return body, rheader, err
+}
+
+// скачать url потоком, сжимая на лету gzip-ом во временный файл в каталоге dir.
+// переименовать временный файл во что-то осмысленное - забота вызывающего
+func (s *Session) Download(realm string, url string, header http.Header, dir string) (tmpname string, rheader http.Header, err error) {
+	rheader, err = s.retry(realm, url, func() (http.Header, error) {
+		body, h, e := s.open(url, header)
+		if e != nil {
+			return h, e
+		}
+		defer body.Close()
+		src := &readCounter{r: body}
+		name, out, e := util.StoreStreamTemp(dir, src, func(in, out int64) {
+			log.Printf("[%s] ... %d octets in, %d octets out", realm, in, out)
+		})
+		if e != nil {
+			if src.err != nil { // сеть, а не диск
+				return nil, &RequestError{url, src.err}
+			}
+			return nil, e
+		}
+		log.Printf("[%s] ... got %d octets, zipped to %d octets (%d%%)",
+			realm, src.n, out, out*100/src.n)
+		tmpname = name
+		return h, nil
+	})
+	return tmpname, rheader, err
 }
 
-func (s *Session) Get(url string) (body []byte) {
+// запрос с повторами согласно RetryPolicy
+func (s *Session) retry(realm string, url string, do func() (http.Header, error)) (rheader http.Header, err error) {
+	s.prepare()
+	for attempt := 1; ; attempt++ {
+		rheader, err = do()
+		if err == nil {
+			log.Printf("[%s] GET %s attempt %d/%d ok", realm, url, attempt, s.Retry.MaxAttempts)
+			return rheader, nil
+		}
+		if _, ok := err.(*NotModifiedError); ok {
+			log.Printf("[%s] GET %s attempt %d/%d: not modified", realm, url, attempt, s.Retry.MaxAttempts)
+			return rheader, err
+		}
+		if !s.Retry.Retryable(err) {
+			log.Printf("[%s] GET %s attempt %d failed, not retryable: %s",
+				realm, url, attempt, err)
+			return nil, err
+		}
+		if attempt >= s.Retry.MaxAttempts {
+			log.Printf("[%s] GET %s failed after %d attempts: %s",
+				realm, url, attempt, err)
+			return nil, err
+		}
+		delay := s.Retry.Delay(attempt, err)
+		log.Printf("[%s] GET %s attempt %d/%d failed: %s; retry in %s",
+			realm, url, attempt, s.Retry.MaxAttempts, err, delay)
+		time.Sleep(delay)
+	}
+}
+
+// создать то, что не задано явно: клиент, политику повторов, ограничитель
+func (s *Session) prepare() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if s.Client == nil {
 		s.Client = new(http.Client)
 	}
+	if s.Retry == nil {
+		s.Retry = NewRetryPolicy(s.Config)
+	}
+	if s.Limiter == nil {
+		s.Limiter = NewRateLimiter(s.Config.FetchRateLimit)
+	}
+}
+
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g *gzipBody) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
+
+type readCounter struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *readCounter) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return
+}
+
+// выполнить запрос и вернуть тело ответа, распакованное, если сервер его сжал
+func (s *Session) open(url string, header http.Header) (body io.ReadCloser, rheader http.Header, err error) {
+	s.Limiter.Wait()
 	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, nil, &RequestError{url, err}
+	}
+	for k, vv := range header {
+		for _, v := range vv {
+			request.Header.Add(k, v)
+		}
+	}
 	request.Header.Add("Accept-Encoding", "gzip")
 	response, err := s.Client.Do(request)
 	if err != nil {
-		log.Fatalf(".. request failed: %s", url, err)
+		return nil, nil, &RequestError{url, err}
+	}
+	if response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+		return nil, response.Header, &NotModifiedError{url}
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, response.Header, &HTTPError{url, response.StatusCode, response.Status,
+			parseRetryAfter(response.Header.Get("Retry-After"))}
 	}
-	defer response.Body.Close()
 
 	// Check that the server actually sent compressed data
-	var reader io.ReadCloser
 	switch response.Header.Get("Content-Encoding") {
 	case "gzip":
-		reader, err = gzip.NewReader(response.Body)
+		reader, err := gzip.NewReader(response.Body)
 		if err != nil {
-			log.Fatalf(".. gzip reader failed: %s", url, err)
+			response.Body.Close()
+			return nil, nil, &DecodeError{url, "gzip", err}
 		}
-		defer reader.Close()
+		return &gzipBody{reader, response.Body}, response.Header, nil
 	default:
-		reader = response.Body
+		return response.Body, response.Header, nil
+	}
+}
+
+func (s *Session) getOnce(url string, header http.Header) (body []byte, rheader http.Header, err error) {
+	reader, rheader, err := s.open(url, header)
+	if err != nil {
+		return nil, rheader, err
 	}
+	defer reader.Close()
 	body, err = ioutil.ReadAll(reader)
 	if err != nil {
-		log.Fatalf(".. request read failed: %s", url, err)
+		return nil, nil, &RequestError{url, err}
 	}
-	return body
+	return body, rheader, nil
 }
 
-func (s *Session) Fetch_FileURL(realm string, locale string) (url string, ts time.Time) {
+func splitRealm(realm string) (region string, slug string, err error) {
 	v := strings.Split(realm, ":")
 	if len(v) != 2 {
-		log.Fatalln("realm is in bad format: '" + realm + "'")
+		return "", "", fmt.Errorf("realm is in bad format: '%s'", realm)
+	}
+	return v[0], v[1], nil
+}
+
+func (s *Session) fetchFileURL(realm string, locale string, cond http.Header) (url string, ts time.Time, rheader http.Header, err error) {
+	region, slug, err := splitRealm(realm)
+	if err != nil {
+		return "", ts, nil, err
 	}
 	var data []byte
-	url = fmt.Sprintf("https://%s.api.battle.net/wow/auction/data/%s?locale=%s&apikey=%s",
-		v[0], v[1], locale, s.Config.APIKey)
-	log.Printf("GET %s ...", url)
-	data = s.Get(url)
+	meta_url := fmt.Sprintf("%s/wow/auction/data/%s?locale=%s&apikey=%s",
+		s.legacyURL(region), slug, locale, s.Config.APIKey)
+	log.Printf("GET %s ...", meta_url)
+	if data, rheader, err = s.GetWithHeader(realm, meta_url, cond); err != nil {
+		return "", ts, nil, err
+	}
 	log.Println("parse auction file metainfo ...")
 
 	var p1 Rec1
-	if err := json.Unmarshal(data, &p1); err != nil {
-		log.Fatalf("... json failed: %s", err)
+	if err = json.Unmarshal(data, &p1); err != nil {
+		return "", ts, nil, &DecodeError{meta_url, "json", err}
+	}
+	if len(p1.Files) == 0 {
+		return "", ts, nil, &NoFilesError{meta_url}
 	}
 	url = p1.Files[0].Url
 	lmt := p1.Files[0].Lmt
 	ts = time.Unix(lmt/1000, lmt%1000).UTC()
 	log.Printf("... url=%s, mtime=%s", url, ts)
-	return
+	return url, ts, rheader, nil
+}
+
+// скачать дамп и сохранить его (сжатым) в DownloadDirectory.
+// режим API (legacy/modern) берётся из конфига. запрос условный:
+// если с прошлого раза дамп не менялся, сервер отвечает 304 и качать нечего
+func (s *Session) FetchTarget(t *Target, locale string) (err error) {
+	st := s.fetchState()
+	cond := st.Header(t.Name())
+	var rheader http.Header
+	switch {
+	case t.Commodities:
+		rheader, err = s.fetchTargetCommodities(t, locale, cond)
+	case s.Config.APIMode == config.API_MODERN:
+		rheader, err = s.fetchTargetModern(t, locale, cond)
+	default:
+		rheader, err = s.fetchTargetLegacy(t, locale, cond)
+	}
+	if _, ok := err.(*NotModifiedError); ok {
+		log.Printf("[%s] not modified since last fetch", t.Name())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	st.Update(t.Name(), rheader)
+	return nil
+}
+
+func (s *Session) fetchTargetLegacy(t *Target, locale string, cond http.Header) (http.Header, error) {
+	realm := t.Name()
+	file_url, file_ts, rheader, err := s.fetchFileURL(realm, locale, cond)
+	if err != nil {
+		return nil, err
+	}
+	if rheader.Get("Last-Modified") == "" {
+		// старый API не всегда шлёт Last-Modified: берём время из метаинформации
+		rheader = cloneHeader(rheader)
+		rheader.Set("Last-Modified", file_ts.UTC().Format(http.TimeFormat))
+	}
+	log.Printf("FILE URL: %s", file_url)
+	log.Printf("FILE PIT: %s / %s", file_ts, util.TSStr(file_ts.UTC()))
+	json_fname := s.Config.DownloadDirectory + util.Make_FName(realm, file_ts, true)
+	if util.CheckSnapshot(json_fname) {
+		log.Println("... already downloaded")
+		return rheader, nil
+	}
+	log.Printf("downloading from %s ...", file_url)
+	tmpname, _, err := s.Download(realm, file_url, nil, s.Config.DownloadDirectory)
+	if err != nil {
+		return nil, err
+	}
+	return rheader, commitSnapshot(tmpname, json_fname)
+}
+
+func (s *Session) fetchTargetModern(t *Target, locale string, cond http.Header) (http.Header, error) {
+	realm := t.Name()
+	region, url, err := s.AuctionsURL(realm, locale)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("downloading from %s ...", url)
+	tmpname, rheader, err := s.DownloadAPI(realm, region, url, cond, s.Config.DownloadDirectory)
+	if err != nil {
+		return nil, err
+	}
+	ts := lastModified(realm, rheader)
+	log.Printf("FILE PIT: %s / %s", ts, util.TSStr(ts.UTC()))
+	json_fname := s.Config.DownloadDirectory + util.Make_FName(realm, ts, true)
+	if err = commitSnapshot(tmpname, json_fname); err != nil {
+		return nil, err
+	}
+	meta := util.SnapshotMeta{
+		Region:         t.Region,
+		ConnectedRealm: t.ConnectedRealm,
+		Realms:         t.Realms,
+		Time:           ts,
+	}
+	return rheader, util.StoreMeta(s.Config.DownloadDirectory+util.Make_MetaFName(realm, ts), &meta)
+}
+
+func (s *Session) fetchTargetCommodities(t *Target, locale string, cond http.Header) (http.Header, error) {
+	url := s.CommoditiesURL(t.Region, locale)
+	log.Printf("downloading from %s ...", url)
+	tmpname, rheader, err := s.DownloadAPI(t.Name(), t.Region, url, cond, s.Config.DownloadDirectory)
+	if err != nil {
+		return nil, err
+	}
+	ts := lastModified(t.Name(), rheader)
+	log.Printf("FILE PIT: %s / %s", ts, util.TSStr(ts.UTC()))
+	json_fname := s.Config.DownloadDirectory + util.Make_CommoditiesFName(t.Region, ts, true)
+	return rheader, commitSnapshot(tmpname, json_fname)
+}
+
+// переименовать скачанный временный файл в окончательное имя снимка.
+// если такой (исправный) снимок уже есть, временный файл просто удаляется
+func commitSnapshot(tmpname string, json_fname string) error {
+	if util.CheckSnapshot(json_fname) {
+		log.Println("... already downloaded")
+		os.Remove(tmpname)
+		return nil
+	}
+	if err := util.CommitTemp(tmpname, json_fname); err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	log.Printf("stored to %s .", json_fname)
+	return nil
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header)
+	for k, vv := range h {
+		c[k] = vv
+	}
+	return c
 }
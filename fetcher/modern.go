@@ -0,0 +1,104 @@
+package fetcher
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// заголовки авторизации и пространства имён (namespace вида "dynamic-eu")
+// поверх extra (могут быть nil)
+func (s *Session) apiHeader(region string, extra http.Header) (http.Header, error) {
+	token, err := s.AccessToken(region)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	for k, vv := range extra {
+		header[k] = vv
+	}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("Battlenet-Namespace", "dynamic-"+region)
+	return header, nil
+}
+
+// выполнить запрос к Game Data API; при 401 токен перезапрашивается один раз
+func (s *Session) withAPIAuth(realm string, region string, extra http.Header, do func(header http.Header) error) error {
+	for pass := 0; ; pass++ {
+		header, err := s.apiHeader(region, extra)
+		if err != nil {
+			return err
+		}
+		err = do(header)
+		if e, ok := err.(*HTTPError); ok && e.StatusCode == http.StatusUnauthorized && pass == 0 {
+			log.Printf("[%s] token rejected, requesting new one", realm)
+			s.DropToken(region)
+			continue
+		}
+		return err
+	}
+}
+
+// GET к Game Data API с OAuth2-токеном
+func (s *Session) GetAPI(realm string, region string, url string, extra http.Header) (body []byte, rheader http.Header, err error) {
+	err = s.withAPIAuth(realm, region, extra, func(header http.Header) (e error) {
+		body, rheader, e = s.GetWithHeader(realm, url, header)
+		return e
+	})
+	return body, rheader, err
+}
+
+// Download к Game Data API с OAuth2-токеном
+func (s *Session) DownloadAPI(realm string, region string, url string, extra http.Header, dir string) (tmpname string, rheader http.Header, err error) {
+	err = s.withAPIAuth(realm, region, extra, func(header http.Header) (e error) {
+		tmpname, rheader, e = s.Download(realm, url, header, dir)
+		return e
+	})
+	return tmpname, rheader, err
+}
+
+func (s *Session) realmResolver() *RealmResolver {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.resolver == nil {
+		s.resolver = NewRealmResolver(s)
+	}
+	return s.resolver
+}
+
+// id connected-realm для реалма вида "region:slug" (см. RealmResolver)
+func (s *Session) ConnectedRealmId(realm string) (region string, id int64, err error) {
+	return s.realmResolver().Resolve(realm)
+}
+
+// то же, но только из кэша, без обращения к API
+func (s *Session) CachedRealmId(realm string) (region string, id int64, err error) {
+	return s.realmResolver().Cached(realm)
+}
+
+// время актуальности дампа из Last-Modified; если его нет - текущее
+func lastModified(realm string, rheader http.Header) time.Time {
+	if t, err := http.ParseTime(rheader.Get("Last-Modified")); err == nil {
+		return t.UTC()
+	}
+	log.Printf("[%s] no Last-Modified in response, use current time", realm)
+	return time.Now().UTC()
+}
+
+// адрес аукционов connected-realm: /data/wow/connected-realm/{id}/auctions
+func (s *Session) AuctionsURL(realm string, locale string) (region string, url string, err error) {
+	region, id, err := s.ConnectedRealmId(realm)
+	if err != nil {
+		return "", "", err
+	}
+	url = fmt.Sprintf("%s/data/wow/connected-realm/%d/auctions?locale=%s",
+		s.apiURL(region), id, locale)
+	return region, url, nil
+}
+
+// адрес аукциона товаров региона: /data/wow/auctions/commodities
+func (s *Session) CommoditiesURL(region string, locale string) string {
+	return fmt.Sprintf("%s/data/wow/auctions/commodities?locale=%s",
+		s.apiURL(region), locale)
+}
@@ -0,0 +1,134 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// токен обновляется заранее, за это время до истечения
+const TOKEN_REFRESH_MARGIN = 5 * time.Minute
+
+type Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int64     `json:"expires_in"` // seconds
+	Expires     time.Time `json:"-"`
+}
+
+func (t *Token) Valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" &&
+		now.Add(TOKEN_REFRESH_MARGIN).Before(t.Expires)
+}
+
+// базовый адрес API: BaseURL сессии, иначе api_base_url из конфига.
+// пустой - настоящие серверы Blizzard. с базовым адресом регион
+// становится первым элементом пути: {base}/eu/data/wow/...
+func (s *Session) baseURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return strings.TrimSuffix(s.Config.APIBaseURL, "/")
+}
+
+func (s *Session) oauthURL(region string) string {
+	if base := s.baseURL(); base != "" {
+		return base + "/" + region + "/oauth/token"
+	}
+	if region == "cn" {
+		return "https://www.battlenet.com.cn/oauth/token"
+	}
+	return fmt.Sprintf("https://%s.battle.net/oauth/token", region)
+}
+
+func (s *Session) apiURL(region string) string {
+	if base := s.baseURL(); base != "" {
+		return base + "/" + region
+	}
+	if region == "cn" {
+		return "https://gateway.battlenet.com.cn"
+	}
+	return fmt.Sprintf("https://%s.api.blizzard.com", region)
+}
+
+// адрес старого API (api.battle.net)
+func (s *Session) legacyURL(region string) string {
+	if base := s.baseURL(); base != "" {
+		return base + "/" + region
+	}
+	return fmt.Sprintf("https://%s.api.battle.net", region)
+}
+
+// получить токен client credentials для региона.
+// токен кэшируется в сессии и обновляется незадолго до истечения
+func (s *Session) AccessToken(region string) (string, error) {
+	s.prepare()
+	// отдельный замок: пока идёт запрос токена, остальные запросы
+	// сессии, которым токен не нужен, ждать не должны
+	s.tokenLock.Lock()
+	defer s.tokenLock.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]*Token)
+	}
+	if t := s.tokens[region]; t.Valid(time.Now()) {
+		return t.AccessToken, nil
+	}
+	t, err := s.requestToken(region)
+	if err != nil {
+		return "", err
+	}
+	s.tokens[region] = t
+	return t.AccessToken, nil
+}
+
+// забыть токен (например, после 401), чтобы следующий запрос получил новый
+func (s *Session) DropToken(region string) {
+	s.tokenLock.Lock()
+	defer s.tokenLock.Unlock()
+	delete(s.tokens, region)
+}
+
+func (s *Session) requestToken(region string) (*Token, error) {
+	if s.Config.ClientID == "" || s.Config.ClientSecret == "" {
+		return nil, fmt.Errorf("client_id and client_secret are required for %s api",
+			s.Config.APIMode)
+	}
+	token_url := s.oauthURL(region)
+	log.Printf("requesting oauth2 token from %s ...", token_url)
+	form := url.Values{"grant_type": {"client_credentials"}}
+	request, err := http.NewRequest("POST", token_url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, &RequestError{token_url, err}
+	}
+	request.SetBasicAuth(s.Config.ClientID, s.Config.ClientSecret)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.Limiter.Wait()
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return nil, &RequestError{token_url, err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &HTTPError{token_url, response.StatusCode, response.Status,
+			parseRetryAfter(response.Header.Get("Retry-After"))}
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &RequestError{token_url, err}
+	}
+	t := new(Token)
+	if err = json.Unmarshal(data, t); err != nil {
+		return nil, &DecodeError{token_url, "json", err}
+	}
+	if t.AccessToken == "" {
+		return nil, &DecodeError{token_url, "json", fmt.Errorf("no access_token")}
+	}
+	t.Expires = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	log.Printf("... got token, expires at %s", t.Expires)
+	return t, nil
+}
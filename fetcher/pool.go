@@ -0,0 +1,128 @@
+package fetcher
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+// ограничитель частоты запросов, общий для всех воркеров сессии
+type RateLimiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// rate - запросов в секунду; 0 или меньше - без ограничений
+func NewRateLimiter(rate float64) *RateLimiter {
+	r := new(RateLimiter)
+	if rate > 0 {
+		r.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return r
+}
+
+// дождаться своей очереди на запрос
+func (r *RateLimiter) Wait() {
+	if r == nil || r.interval == 0 {
+		return
+	}
+	r.lock.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.lock.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type FetchResult struct {
+	Realm    string
+	Locale   string
+	Err      error
+	Duration time.Duration
+}
+
+// скачать все цели по всем локалям в concurrency потоков.
+// локали одной цели качаются одним воркером по очереди, чтобы два потока
+// не писали один и тот же файл. результаты идут в порядке целей и локалей
+func (s *Session) FetchAll(targets []*Target, locales []string, concurrency int) []FetchResult {
+	s.prepare()
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	log.Printf("fetching %d targets in %d workers", len(targets), concurrency)
+	results := make([]FetchResult, len(targets)*len(locales))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				t := targets[i]
+				for j, locale := range locales {
+					if util.StopRequested() {
+						results[i*len(locales)+j] = FetchResult{
+							Realm:  t.Name(),
+							Locale: locale,
+							Err:    fmt.Errorf("skipped: stop requested"),
+						}
+						continue
+					}
+					started := time.Now()
+					err := s.FetchTarget(t, locale)
+					results[i*len(locales)+j] = FetchResult{
+						Realm:    t.Name(),
+						Locale:   locale,
+						Err:      err,
+						Duration: time.Since(started),
+					}
+				}
+			}
+		}()
+	}
+	for i := range targets {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// выкачать свежие дампы по всем реалмам и локалям конфига.
+// возвращает список "realm/locale", по которым скачать не удалось
+func FetchConfigured(cf *config.Config) (failed []string) {
+	log.Println("=== FETCH BEGIN ===")
+	s := new(Session)
+	s.Config = cf
+	targets, failed := s.Targets()
+	results := s.FetchAll(targets, cf.LocalesList, cf.FetchConcurrency)
+	log.Println("fetch results:")
+	for _, r := range results {
+		if r.Err != nil {
+			log.Printf("    %s/%s: FAILED in %s: %s", r.Realm, r.Locale, r.Duration, r.Err)
+			failed = append(failed, r.Realm+"/"+r.Locale)
+		} else {
+			log.Printf("    %s/%s: ok in %s", r.Realm, r.Locale, r.Duration)
+		}
+	}
+	if len(failed) == 0 {
+		log.Println("all realms fetched without errors")
+	} else {
+		log.Printf("%d realms failed:", len(failed))
+		for _, name := range failed {
+			log.Printf("    %s", name)
+		}
+	}
+	log.Println("=== FETCH END ===")
+	return failed
+}
@@ -0,0 +1,201 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const REALM_CACHE_NAME = "connected-realms.json"
+
+var rxConnectedRealm = regexp.MustCompile("/connected-realm/(\\d+)")
+
+// отображение "region:slug" -> id connected-realm с кэшем на диске
+type RealmResolver struct {
+	s      *Session
+	fname  string
+	lock   sync.Mutex
+	loaded bool
+	ids    map[string]int64
+}
+
+type realmInfo struct {
+	Id             int64 `json:"id"`
+	ConnectedRealm struct {
+		Href string `json:"href"`
+	} `json:"connected_realm"`
+}
+
+func NewRealmResolver(s *Session) *RealmResolver {
+	r := new(RealmResolver)
+	r.s = s
+	r.fname = s.Config.TempDirectory + REALM_CACHE_NAME
+	r.ids = make(map[string]int64)
+	return r
+}
+
+func (r *RealmResolver) load() {
+	if r.loaded {
+		return
+	}
+	r.loaded = true
+	if !util.CheckFile(r.fname) {
+		return
+	}
+	data, err := util.Load(r.fname)
+	if err == nil {
+		err = json.Unmarshal(data, &r.ids)
+	}
+	if err != nil {
+		log.Printf("connected realm cache %s is broken, ignored: %s", r.fname, err)
+		r.ids = make(map[string]int64)
+		return
+	}
+	log.Printf("connected realm cache %s: %d entries", r.fname, len(r.ids))
+}
+
+func (r *RealmResolver) save() {
+	data, err := json.Marshal(r.ids)
+	if err == nil {
+		err = util.Store(r.fname, data)
+	}
+	if err != nil {
+		log.Printf("connected realm cache %s not saved: %s", r.fname, err)
+	}
+}
+
+// id connected-realm для реалма вида "region:slug".
+// slug может быть и самим id ("eu:1602")
+func (r *RealmResolver) Resolve(realm string) (region string, id int64, err error) {
+	region, slug, err := splitRealm(realm)
+	if err != nil {
+		return "", 0, err
+	}
+	if id, err = strconv.ParseInt(slug, 10, 64); err == nil {
+		return region, id, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if id, ok := r.cached(realm); ok {
+		return region, id, nil
+	}
+	url := fmt.Sprintf("%s/data/wow/realm/%s", r.s.apiURL(region), slug)
+	log.Printf("resolve connected realm for %s: GET %s ...", realm, url)
+	data, _, err := r.s.GetAPI(realm, region, url, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	var info realmInfo
+	if err = json.Unmarshal(data, &info); err != nil {
+		return "", 0, &DecodeError{url, "json", err}
+	}
+	v := rxConnectedRealm.FindStringSubmatch(info.ConnectedRealm.Href)
+	if v == nil {
+		return "", 0, &DecodeError{url, "json",
+			fmt.Errorf("no connected realm href in realm info")}
+	}
+	id, _ = strconv.ParseInt(v[1], 10, 64)
+	log.Printf("... %s is in connected realm %d", realm, id)
+	r.ids[realm] = id
+	r.save()
+	return region, id, nil
+}
+
+// Resolve без обращения к API: только числовой slug или кэш
+func (r *RealmResolver) Cached(realm string) (region string, id int64, err error) {
+	region, slug, err := splitRealm(realm)
+	if err != nil {
+		return "", 0, err
+	}
+	if id, err = strconv.ParseInt(slug, 10, 64); err == nil {
+		return region, id, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if id, ok := r.cached(realm); ok {
+		return region, id, nil
+	}
+	return "", 0, fmt.Errorf("%s is not in connected realm cache %s", realm, r.fname)
+}
+
+func (r *RealmResolver) cached(realm string) (id int64, ok bool) {
+	r.load()
+	id, ok = r.ids[realm]
+	return id, ok
+}
+
+// что качать: один аукцион, общий для одного или нескольких реалмов.
+// снимок сохраняется под именем первого реалма из списка
+type Target struct {
+	Region         string
+	ConnectedRealm int64 // 0 для legacy
+	Realms         []string
+	Commodities    bool // аукцион товаров всего региона
+}
+
+func (t *Target) Name() string {
+	return t.Realms[0]
+}
+
+// составить список целей из конфига. в режиме modern реалмы, которые делят
+// один аукцион (connected-realm), объединяются в одну цель,
+// и при включенном commodities добавляется по цели на каждый регион.
+// возвращает также реалмы, для которых не удалось определить connected-realm
+func (s *Session) Targets() (targets []*Target, failed []string) {
+	return s.targets(s.ConnectedRealmId)
+}
+
+func (s *Session) targets(resolve func(realm string) (string, int64, error)) (targets []*Target, failed []string) {
+	if s.Config.APIMode != config.API_MODERN {
+		for _, realm := range s.Config.RealmsList {
+			targets = append(targets, &Target{Realms: []string{realm}})
+		}
+		return targets, nil
+	}
+	bykey := make(map[string]*Target)
+	for _, realm := range s.Config.RealmsList {
+		region, id, err := resolve(realm)
+		if err != nil {
+			log.Printf("%s: connected realm not resolved: %s", realm, err)
+			failed = append(failed, realm)
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", region, id)
+		if t, exists := bykey[key]; exists {
+			log.Printf("%s shares auction house with %s", realm, t.Name())
+			t.Realms = append(t.Realms, realm)
+			continue
+		}
+		t := &Target{Region: region, ConnectedRealm: id, Realms: []string{realm}}
+		bykey[key] = t
+		targets = append(targets, t)
+	}
+	if s.Config.FetchCommodities {
+		for _, region := range s.Config.Regions() {
+			targets = append(targets, &Target{
+				Region:      region,
+				Realms:      []string{util.CommoditiesRealm(region)},
+				Commodities: true,
+			})
+		}
+	}
+	return targets, failed
+}
+
+// имена, под которыми лежат снимки: по одному на цель, как в Targets,
+// но connected-realm берётся только из кэша, так что в сеть не ходит.
+// реалмы, которых в кэше нет, идут под своим именем:
+// вдруг их снимки уже скачаны раньше
+func (s *Session) SnapshotNames() (names []string) {
+	targets, failed := s.targets(s.CachedRealmId)
+	for _, t := range targets {
+		names = append(names, t.Name())
+	}
+	return append(names, failed...)
+}
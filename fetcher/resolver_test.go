@@ -0,0 +1,42 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+// parse берёт имена снимков только из кэша connected-realm:
+// API недоступен, а имена те же, что у целей fetch
+func TestSnapshotNamesOffline(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+		http.Error(w, "no", http.StatusNotFound)
+	}))
+	defer api.Close()
+	cf := config.Default(t.TempDir())
+	cf.APIMode = config.API_MODERN
+	cf.APIBaseURL = api.URL
+	cf.ClientID = "id"
+	cf.ClientSecret = "secret"
+	cf.RetryAttempts = 1
+	cf.RealmsList = []string{"eu:a", "eu:b", "eu:1602", "eu:unknown"}
+	cf.FetchCommodities = true
+	util.CheckDir(cf.TempDirectory)
+	data, _ := json.Marshal(map[string]int64{"eu:a": 1602, "eu:b": 1602, "eu:c": 7})
+	if err := util.Store(cf.TempDirectory+REALM_CACHE_NAME, data); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Session{Config: cf}
+	got := s.SnapshotNames()
+	want := []string{"eu:a", util.CommoditiesRealm("eu"), "eu:unknown"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot names %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package fetcher
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	StatusCodes map[int]bool
+}
+
+func parseDelay(name string, s string, dflt time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		log.Printf("bad %s value '%s', use %s", name, s, dflt)
+		return dflt
+	}
+	return d
+}
+
+func NewRetryPolicy(cf *config.Config) *RetryPolicy {
+	p := new(RetryPolicy)
+	p.MaxAttempts = cf.RetryAttempts
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	p.BaseDelay = parseDelay("retry_base_delay", cf.RetryBaseDelay, 2*time.Second)
+	p.MaxDelay = parseDelay("retry_max_delay", cf.RetryMaxDelay, 2*time.Minute)
+	p.StatusCodes = make(map[int]bool)
+	for _, code := range cf.RetryStatusCodes {
+		p.StatusCodes[code] = true
+	}
+	return p
+}
+
+// можно ли повторять запрос после такой ошибки
+func (p *RetryPolicy) Retryable(err error) bool {
+	switch e := err.(type) {
+	case *RequestError:
+		return true
+	case *HTTPError:
+		return p.StatusCodes[e.StatusCode]
+	}
+	return false
+}
+
+// пауза перед попыткой номер attempt+1 (attempt считается с единицы):
+// экспонента от BaseDelay, урезанная до MaxDelay, со случайной добавкой.
+// Retry-After от сервера соблюдается, если он требует ждать дольше
+func (p *RetryPolicy) Delay(attempt int, err error) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	if e, ok := err.(*HTTPError); ok && d < e.RetryAfter {
+		d = e.RetryAfter
+	}
+	return d
+}
+
+// разобрать заголовок Retry-After (секунды или HTTP-дата)
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
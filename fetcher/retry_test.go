@@ -0,0 +1,91 @@
+package fetcher
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    10 * time.Second,
+		StatusCodes: map[int]bool{429: true, 503: true},
+	}
+}
+
+func TestDelayBounds(t *testing.T) {
+	p := testPolicy()
+	cases := []struct {
+		attempt int
+		lo, hi  time.Duration
+	}{
+		{1, 1 * time.Second, 2 * time.Second},
+		{2, 2 * time.Second, 4 * time.Second},
+		{3, 4 * time.Second, 8 * time.Second},
+		{4, 5 * time.Second, 10 * time.Second}, // урезано до MaxDelay
+		{10, 5 * time.Second, 10 * time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			d := p.Delay(c.attempt, &RequestError{"http://x/", nil})
+			if d < c.lo || d > c.hi {
+				t.Fatalf("attempt %d: delay %s not in [%s, %s]", c.attempt, d, c.lo, c.hi)
+			}
+		}
+	}
+}
+
+func TestDelayRetryAfter(t *testing.T) {
+	p := testPolicy()
+	err := &HTTPError{StatusCode: 429, RetryAfter: time.Minute}
+	if d := p.Delay(1, err); d != time.Minute {
+		t.Errorf("Retry-After longer than backoff: got %s, want 1m", d)
+	}
+	err = &HTTPError{StatusCode: 429, RetryAfter: time.Millisecond}
+	if d := p.Delay(1, err); d < time.Second {
+		t.Errorf("Retry-After shorter than backoff: got %s, want at least 1s", d)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	p := testPolicy()
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&RequestError{"http://x/", nil}, true},
+		{&HTTPError{StatusCode: 503}, true},
+		{&HTTPError{StatusCode: 404}, false},
+		{&NotModifiedError{}, false},
+	}
+	for _, c := range cases {
+		if got := p.Retryable(c.err); got != c.want {
+			t.Errorf("Retryable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter(""); d != 0 {
+		t.Errorf("empty: got %s", d)
+	}
+	if d := parseRetryAfter("30"); d != 30*time.Second {
+		t.Errorf("seconds: got %s, want 30s", d)
+	}
+	if d := parseRetryAfter("garbage"); d != 0 {
+		t.Errorf("garbage: got %s", d)
+	}
+	if d := parseRetryAfter("-5"); d != 0 {
+		t.Errorf("negative: got %s", d)
+	}
+	future := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(future); d < 80*time.Second || d > 90*time.Second {
+		t.Errorf("http-date: got %s, want about 90s", d)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(past); d != 0 {
+		t.Errorf("past http-date: got %s", d)
+	}
+}
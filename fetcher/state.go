@@ -0,0 +1,92 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const FETCH_STATE_NAME = "fetch-state.json"
+
+// что сервер отдал в прошлый раз: для If-Modified-Since / If-None-Match
+type ResourceState struct {
+	LastModified string `json:"lastModified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+}
+
+// состояние условных запросов по реалмам, хранится в TempDirectory
+type FetchState struct {
+	fname   string
+	lock    sync.Mutex
+	Entries map[string]ResourceState `json:"entries"`
+}
+
+func LoadFetchState(fname string) *FetchState {
+	st := new(FetchState)
+	st.fname = fname
+	st.Entries = make(map[string]ResourceState)
+	if !util.CheckFile(fname) {
+		return st
+	}
+	data, err := util.Load(fname)
+	if err == nil {
+		err = json.Unmarshal(data, st)
+	}
+	if err != nil || st.Entries == nil {
+		log.Printf("fetch state %s is broken, ignored: %v", fname, err)
+		st.Entries = make(map[string]ResourceState)
+	}
+	return st
+}
+
+// заголовки условного запроса для реалма (пустые, если реалм ещё не качали)
+func (st *FetchState) Header(realm string) http.Header {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	header := make(http.Header)
+	e := st.Entries[realm]
+	if e.LastModified != "" {
+		header.Set("If-Modified-Since", e.LastModified)
+	}
+	if e.ETag != "" {
+		header.Set("If-None-Match", e.ETag)
+	}
+	return header
+}
+
+// запомнить Last-Modified/ETag из ответа и сохранить состояние на диск.
+// вызывать только после того, как снимок действительно сохранён
+func (st *FetchState) Update(realm string, rheader http.Header) {
+	if rheader == nil {
+		return
+	}
+	e := ResourceState{
+		LastModified: rheader.Get("Last-Modified"),
+		ETag:         rheader.Get("ETag"),
+	}
+	if e.LastModified == "" && e.ETag == "" {
+		return
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.Entries[realm] = e
+	data, err := json.Marshal(st)
+	if err == nil {
+		err = util.Store(st.fname, data)
+	}
+	if err != nil {
+		log.Printf("fetch state %s not saved: %s", st.fname, err)
+	}
+}
+
+func (s *Session) fetchState() *FetchState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.state == nil {
+		s.state = LoadFetchState(s.Config.TempDirectory + FETCH_STATE_NAME)
+	}
+	return s.state
+}
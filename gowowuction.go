@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	backup "github.com/gourytch/gowowuction/backup"
 	config "github.com/gourytch/gowowuction/config"
@@ -11,39 +13,54 @@ import (
 	util "github.com/gourytch/gowowuction/util"
 )
 
-func DoFetch(cf *config.Config) {
-	log.Println("=== FETCH BEGIN ===")
-	s := new(fetcher.Session)
-	s.Config = cf
-	for _, realm := range cf.RealmsList {
-		for _, locale := range cf.LocalesList {
-			file_url, file_ts := s.Fetch_FileURL(realm, locale)
-			log.Printf("FILE URL: %s", file_url)
-			log.Printf("FILE PIT: %s / %s", file_ts, util.TSStr(file_ts.UTC()))
-			fname := util.Make_FName(realm, file_ts, true)
-			json_fname := cf.DownloadDirectory + fname
-			if !util.CheckFile(json_fname) {
-				log.Printf("downloading from %s ...", file_url)
-				data := s.Get(file_url)
-				log.Printf("... got %d octets", len(data))
-				zdata := util.Zip(data)
-				log.Printf("... zipped to %d octets (%d%%)",
-					len(zdata), len(zdata)*100/len(data))
-				util.Store(json_fname, zdata)
-				log.Printf("stored to %s .", json_fname)
-			} else {
-				log.Println("... already downloaded")
-			}
-		}
-	}
-	log.Println("=== FETCH END ===")
+// выкачать свежие дампы по всем реалмам и локалям.
+// возвращает список "realm/locale", по которым скачать не удалось
+func DoFetch(cf *config.Config) (failed []string) {
+	return fetcher.FetchConfigured(cf)
 }
 
+// у каждого реалма свои файлы состояния и результатов,
+// так что реалмы разбираются параллельно, не больше ParseConcurrency сразу
 func DoParse(cf *config.Config) {
 	log.Println("=== PARSE BEGIN ===")
-	for _, realm := range cf.RealmsList {
-		parser.ParseDir(cf, realm, false)
+	// реалмы с общим аукционом разбираются один раз, под именем снимка
+	s := &fetcher.Session{Config: cf}
+	realms := s.SnapshotNames()
+	concurrency := cf.ParseConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	log.Printf("parsing %d realms in %d workers", len(realms), concurrency)
+	started := time.Now()
+	stats := make([]*parser.PipelineStats, len(realms))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if util.StopRequested() {
+					log.Printf("[%s] skipped: stop requested", realms[i])
+					continue
+				}
+				stats[i] = parser.ParseDir(cf, realms[i], false)
+			}
+		}()
+	}
+	for i := range realms {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	total := new(parser.PipelineStats)
+	for _, st := range stats {
+		if st != nil {
+			total.Add(st)
+		}
 	}
+	total.Wall = time.Since(started) // реалмы шли параллельно, сумма не годится
+	total.Print()
 	log.Println("=== PARSE END ===")
 }
 
@@ -69,22 +86,61 @@ func main() {
 
 	util.CheckDir(cf.DownloadDirectory)
 	util.CheckDir(cf.ResultDirectory)
+	util.CheckDir(cf.TempDirectory)
 
+	// блокировка нужна только командам, которые пишут в каталоги;
+	// отчёты (marketvalue, sales, seller) только читают и идут параллельно
+	var lock *util.LockFile
+	locked := func() {
+		if lock != nil {
+			return
+		}
+		if lock, err = util.Lock(cf.LockFile); err != nil {
+			log.Fatalln("another instance is running: ", err)
+		}
+	}
+
+	status := 0
 	if len(os.Args) == 0 {
-		DoFetch(cf)
+		locked()
+		if len(DoFetch(cf)) > 0 {
+			status = 1
+		}
 	} else {
-		for _, arg := range os.Args[1:] {
+		// команды идут подряд; команда с флагами забирает свои аргументы
+		args := os.Args[1:]
+		for len(args) > 0 {
+			arg := args[0]
+			args = args[1:]
 			switch arg {
 			case "fetch":
-				DoFetch(cf)
+				locked()
+				if len(DoFetch(cf)) > 0 {
+					status = 1
+				}
 			case "parse":
+				locked()
 				DoParse(cf)
 			case "backup":
+				locked()
 				DoBackup(cf)
+			case "daemon":
+				locked()
+				DoDaemon(cf)
+			case "marketvalue":
+				args = DoMarketValue(cf, args)
+			case "sales":
+				args = DoSales(cf, args)
+			case "seller":
+				args = DoSeller(cf, args)
 			default:
 				log.Fatalf("unknown arg: \"%s\"", arg)
 			}
 		}
 	}
 	log.Println("done")
+	if lock != nil {
+		lock.Unlock()
+	}
+	os.Exit(status)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+
+	config "github.com/gourytch/gowowuction/config"
+	parser "github.com/gourytch/gowowuction/parser"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+// gowowuction marketvalue --realm R --item ID [--pet N] [--at TS] [--days N]
+// gowowuction marketvalue --realm R --export FILE|-
+func DoMarketValue(cf *config.Config, args []string) []string {
+	fs := newReportFlags("marketvalue", cf.MarketWindowDays, "estimate at", "smoothing window, days")
+	realm, days := fs.Realm, fs.Days
+	item := fs.Int64("item", 0, "item id")
+	pet := fs.Int("pet", 0, "pet species id (for caged pets)")
+	export := fs.String("export", "", "write market values of all items as CSV to file ('-' for stdout)")
+	fs.Parse(args)
+	fs.Require((*item == 0) != (*export == ""), "either --item or --export")
+	when := fs.End()
+
+	var only *parser.ItemKey
+	if *item != 0 {
+		only = &parser.ItemKey{Item: *item, Pet: *pet}
+	}
+	values, err := parser.MarketValues(cf, *realm, when, fs.Window(), only)
+	if err != nil {
+		log.Fatalf("marketvalue: %s", err)
+	}
+	if only != nil {
+		mv := values[*only]
+		if mv == nil {
+			fmt.Printf("%s item %d: no priced snapshots in %d days before %s\n",
+				*realm, *item, *days, util.TSStr(when))
+			return fs.Args()
+		}
+		for _, d := range mv.Daily {
+			fmt.Printf("%s %16s\n", d.Day.Format("2006-01-02"), util.FormatMoney(d.Value))
+		}
+		fmt.Printf("%s item %d: market value %s per unit (%d snapshots in %d days), last seen %s at min %s\n",
+			*realm, *item, util.FormatMoney(mv.Value), mv.Snapshots, *days,
+			util.TSStr(mv.Last), util.FormatMoney(mv.LastMin))
+		return fs.Args()
+	}
+
+	fs.Export(*export, func(w io.Writer) error {
+		return exportMarketValues(w, values)
+	})
+	log.Printf("marketvalue: %d items exported", len(values))
+	return fs.Args()
+}
+
+func exportMarketValues(w io.Writer, values map[parser.ItemKey]*parser.MarketValue) error {
+	var list []*parser.MarketValue
+	for _, mv := range values {
+		list = append(list, mv)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Item != list[j].Item {
+			return list[i].Item < list[j].Item
+		}
+		return list[i].Pet < list[j].Pet
+	})
+	c := csv.NewWriter(w)
+	c.Write([]string{"item", "pet", "market_value", "snapshots", "last_seen", "last_min"})
+	for _, mv := range list {
+		c.Write([]string{
+			strconv.FormatInt(mv.Item, 10),
+			strconv.Itoa(mv.Pet),
+			strconv.FormatInt(mv.Value, 10),
+			strconv.Itoa(mv.Snapshots),
+			util.TSStr(mv.Last),
+			strconv.FormatInt(mv.LastMin, 10),
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,126 @@
+package mockapi_test
+
+// fetch -> parse целиком: поддельный сервер на фикстурах apps/auc-mock,
+// настоящие fetcher.Session и parser.ParseDir во временном каталоге
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/gourytch/gowowuction/config"
+	fetcher "github.com/gourytch/gowowuction/fetcher"
+	mockapi "github.com/gourytch/gowowuction/mockapi"
+	parser "github.com/gourytch/gowowuction/parser"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const FIXTURES = "../apps/auc-mock/fixtures"
+
+func countLines(t *testing.T, fname string) int {
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		n++
+	}
+	return n
+}
+
+func runFetchParse(t *testing.T, mode string, opt mockapi.Options) {
+	opt.Dir = FIXTURES
+	m, err := mockapi.New(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Start()
+	defer m.Close()
+
+	cf := config.Default(t.TempDir())
+	cf.APIMode = mode
+	cf.APIKey = "mock"
+	cf.ClientID = "mock"
+	cf.ClientSecret = "mock"
+	cf.APIBaseURL = m.URL
+	cf.LocalesList = []string{"en_US"}
+	cf.RetryBaseDelay = "1ms"
+	cf.RetryMaxDelay = "10ms"
+	cf.FetchRateLimit = 0
+	cf.RealmsList = nil
+	for _, realm := range m.Realms() {
+		if util.IsCommoditiesRealm(realm) {
+			cf.FetchCommodities = mode == config.API_MODERN
+		} else {
+			cf.RealmsList = append(cf.RealmsList, realm)
+		}
+	}
+	util.CheckDir(cf.DownloadDirectory)
+	util.CheckDir(cf.TempDirectory)
+	util.CheckDir(cf.ResultDirectory)
+
+	s := &fetcher.Session{Config: cf}
+	for step := 0; step < m.Steps(); step++ {
+		targets, failed := s.Targets()
+		if len(failed) > 0 {
+			t.Fatalf("step %d: unresolved realms %v", step, failed)
+		}
+		for _, r := range s.FetchAll(targets, cf.LocalesList, cf.FetchConcurrency) {
+			if r.Err != nil {
+				t.Errorf("step %d: %s/%s: %s", step, r.Realm, r.Locale, r.Err)
+			}
+		}
+		m.Step()
+	}
+
+	for _, realm := range s.SnapshotNames() {
+		snapshots, _ := filepath.Glob(cf.DownloadDirectory + util.Safe_Realm(realm) + "-*.json.gz")
+		if len(snapshots) == 0 {
+			t.Errorf("%s: nothing downloaded", realm)
+			continue
+		}
+		if mode == config.API_MODERN && !util.IsCommoditiesRealm(realm) {
+			// у снимка общего аукциона рядом лежит список его реалмов
+			for _, fname := range snapshots {
+				meta := strings.TrimSuffix(fname, ".json.gz") + ".meta.json"
+				if !util.CheckFile(meta) {
+					t.Errorf("%s: no metadata %s", realm, meta)
+				}
+			}
+		}
+		stats := parser.ParseDir(cf, realm, false)
+		if stats.Process.Files != len(snapshots) {
+			t.Errorf("%s: %d snapshots processed, %d downloaded",
+				realm, stats.Process.Files, len(snapshots))
+		}
+		info, _ := filepath.Glob(cf.ResultDirectory + "*-" + util.Safe_Realm(realm) + "-snapshot")
+		n := 0
+		for _, fname := range info {
+			n += countLines(t, fname)
+		}
+		if n != len(snapshots) {
+			t.Errorf("%s: %d snapshot info lines, want %d", realm, n, len(snapshots))
+		}
+	}
+}
+
+func TestFetchParseLegacy(t *testing.T) {
+	runFetchParse(t, config.API_LEGACY, mockapi.Options{Conditional: true})
+}
+
+func TestFetchParseModern(t *testing.T) {
+	runFetchParse(t, config.API_MODERN, mockapi.Options{Conditional: true})
+}
+
+// сбои сервера и сжатые ответы: повторы должны довести дело до конца
+func TestFetchParseFlaky(t *testing.T) {
+	for _, mode := range []string{config.API_LEGACY, config.API_MODERN} {
+		t.Run(mode, func(t *testing.T) {
+			runFetchParse(t, mode, mockapi.Options{FailEvery: 3, Gzip: true, Conditional: true})
+		})
+	}
+}
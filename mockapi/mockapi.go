@@ -0,0 +1,276 @@
+package mockapi
+
+// поддельный Battle.net API для прогона fetch -> parse без сети.
+// отдаёт снимки из каталога с фикстурами (имена как у снимков в
+// DownloadDirectory, сжатые или нет: eu-fordragon-20261018_120000.json[.gz]).
+// пути такие же, как у настоящего API, но с регионом впереди
+// (см. fetcher.Session.BaseURL): /eu/wow/auction/data/fordragon,
+// /eu/oauth/token, /eu/data/wow/realm/fordragon,
+// /eu/data/wow/connected-realm/1/auctions, /eu/data/wow/auctions/commodities
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type Options struct {
+	Dir         string        // каталог с фикстурами
+	Latency     time.Duration // задержка перед каждым ответом
+	FailEvery   int           // каждый N-й запрос получает ошибку (0 - никогда)
+	FailCode    int           // код этой ошибки (по умолчанию 503)
+	Gzip        bool          // отдавать с Content-Encoding: gzip
+	Conditional bool          // отвечать 304 на If-Modified-Since / If-None-Match
+}
+
+type fixture struct {
+	fname string
+	ts    time.Time
+}
+
+type Server struct {
+	Options
+	URL string
+
+	lock     sync.Mutex
+	srv      *httptest.Server
+	fixtures map[string][]fixture // realm -> снимки по времени
+	ids      map[string]int64     // realm -> id connected-realm
+	realms   map[int64]string     // id connected-realm -> realm
+	step     int
+	requests int
+}
+
+var (
+	rxLegacy  = regexp.MustCompile("^/([^/]+)/wow/auction/data/([^/]+)$")
+	rxToken   = regexp.MustCompile("^/([^/]+)/oauth/token$")
+	rxRealm   = regexp.MustCompile("^/([^/]+)/data/wow/realm/([^/]+)$")
+	rxCRAucs  = regexp.MustCompile("^/([^/]+)/data/wow/connected-realm/(\\d+)/auctions$")
+	rxCommods = regexp.MustCompile("^/([^/]+)/data/wow/auctions/commodities$")
+	rxDump    = regexp.MustCompile("^/dumps/([^/]+)$")
+)
+
+// собрать список фикстур. каждому реалму выдаётся свой id connected-realm
+func New(opt Options) (*Server, error) {
+	m := &Server{Options: opt}
+	if m.FailCode == 0 {
+		m.FailCode = http.StatusServiceUnavailable
+	}
+	m.fixtures = make(map[string][]fixture)
+	m.ids = make(map[string]int64)
+	m.realms = make(map[int64]string)
+	fnames, err := filepath.Glob(filepath.Join(opt.Dir, "*.json*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, fname := range fnames {
+		name := filepath.Base(fname)
+		if !strings.HasSuffix(name, ".gz") {
+			name += ".gz"
+		}
+		realm, ts, good := util.Parse_AnyFName(name)
+		if !good {
+			continue
+		}
+		m.fixtures[realm] = append(m.fixtures[realm], fixture{fname, ts})
+	}
+	var realms []string
+	for realm, list := range m.fixtures {
+		sort.Slice(list, func(i, j int) bool { return list[i].ts.Before(list[j].ts) })
+		realms = append(realms, realm)
+	}
+	sort.Strings(realms)
+	for i, realm := range realms {
+		m.ids[realm] = int64(i + 1)
+		m.realms[int64(i+1)] = realm
+	}
+	if len(realms) == 0 {
+		return nil, fmt.Errorf("no fixtures in %s", opt.Dir)
+	}
+	log.Printf("mockapi: %d realms in %s: %v", len(realms), opt.Dir, realms)
+	return m, nil
+}
+
+// запустить на случайном локальном порту
+func (m *Server) Start() {
+	m.srv = httptest.NewServer(m)
+	m.URL = m.srv.URL
+	log.Printf("mockapi: listening at %s", m.URL)
+}
+
+func (m *Server) Close() {
+	if m.srv != nil {
+		m.srv.Close()
+	}
+}
+
+// реалмы (включая псевдо-реалмы commodities), для которых есть фикстуры
+func (m *Server) Realms() (realms []string) {
+	for realm := range m.fixtures {
+		realms = append(realms, realm)
+	}
+	sort.Strings(realms)
+	return realms
+}
+
+// сколько шагов можно сделать: по самому длинному ряду снимков
+func (m *Server) Steps() int {
+	n := 0
+	for _, list := range m.fixtures {
+		if len(list) > n {
+			n = len(list)
+		}
+	}
+	return n
+}
+
+// перейти к следующему по времени снимку (у реалмов с короткой
+// историей остаётся последний)
+func (m *Server) Step() {
+	m.lock.Lock()
+	m.step++
+	m.lock.Unlock()
+}
+
+func (m *Server) current(realm string) (fixture, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	list := m.fixtures[realm]
+	if len(list) == 0 {
+		return fixture{}, false
+	}
+	if m.step < len(list) {
+		return list[m.step], true
+	}
+	return list[len(list)-1], true
+}
+
+func (m *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.Latency > 0 {
+		time.Sleep(m.Latency)
+	}
+	m.lock.Lock()
+	m.requests++
+	fail := m.FailEvery > 0 && m.requests%m.FailEvery == 0
+	m.lock.Unlock()
+	if fail {
+		log.Printf("mockapi: %s -> forced %d", r.URL.Path, m.FailCode)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "forced failure", m.FailCode)
+		return
+	}
+	path := r.URL.Path
+	if v := rxToken.FindStringSubmatch(path); v != nil {
+		m.reply(w, r, []byte(`{"access_token":"mock","token_type":"bearer","expires_in":86400}`), time.Time{})
+		return
+	}
+	if v := rxLegacy.FindStringSubmatch(path); v != nil {
+		f, ok := m.current(v[1] + ":" + v[2])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		meta := fmt.Sprintf(`{"files":[{"url":"%s/dumps/%s","lastModified":%d}]}`,
+			m.URL, filepath.Base(f.fname), f.ts.Unix()*1000)
+		m.reply(w, r, []byte(meta), f.ts)
+		return
+	}
+	if v := rxRealm.FindStringSubmatch(path); v != nil {
+		id, ok := m.ids[v[1]+":"+v[2]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		info := fmt.Sprintf(`{"id":%d,"connected_realm":{"href":"%s/%s/data/wow/connected-realm/%d"}}`,
+			id, m.URL, v[1], id)
+		m.reply(w, r, []byte(info), time.Time{})
+		return
+	}
+	if v := rxCRAucs.FindStringSubmatch(path); v != nil {
+		id, _ := strconv.ParseInt(v[2], 10, 64)
+		m.serveFixture(w, r, m.realms[id])
+		return
+	}
+	if v := rxCommods.FindStringSubmatch(path); v != nil {
+		m.serveFixture(w, r, util.CommoditiesRealm(v[1]))
+		return
+	}
+	if v := rxDump.FindStringSubmatch(path); v != nil {
+		name := strings.TrimSuffix(v[1], ".gz") + ".gz"
+		realm, ts, good := util.Parse_AnyFName(name)
+		if !good {
+			http.NotFound(w, r)
+			return
+		}
+		for _, f := range m.fixtures[realm] {
+			if f.ts.Equal(ts) {
+				m.serveFile(w, r, f)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (m *Server) serveFixture(w http.ResponseWriter, r *http.Request, realm string) {
+	f, ok := m.current(realm)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	m.serveFile(w, r, f)
+}
+
+func (m *Server) serveFile(w http.ResponseWriter, r *http.Request, f fixture) {
+	data, err := util.Load(f.fname)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.reply(w, r, data, f.ts)
+}
+
+// ответить данными; ts - время изменения для Last-Modified/ETag (может быть нулевым)
+func (m *Server) reply(w http.ResponseWriter, r *http.Request, data []byte, ts time.Time) {
+	if !ts.IsZero() {
+		etag := fmt.Sprintf(`"%d"`, ts.Unix())
+		w.Header().Set("Last-Modified", ts.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", etag)
+		if m.Conditional && notModified(r, ts, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if m.Gzip && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		var buf bytes.Buffer
+		z := gzip.NewWriter(&buf)
+		z.Write(data)
+		z.Close()
+		data = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Write(data)
+}
+
+func notModified(r *http.Request, ts time.Time, etag string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return inm == etag
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !ts.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -36,21 +36,24 @@ func ProcessSnapshot(ss *SnapshotData) {
 	}
 }
 
-func ParseDir(cf *config.Config, realm string, safe bool) {
+// разобрать все снимки реалма в DownloadDirectory (см. pipeline.go)
+func ParseDir(cf *config.Config, realm string, safe bool) *PipelineStats {
+	prc := new(AuctionProcessor)
+	prc.Init(cf, realm)
 	mask := cf.DownloadDirectory +
 		strings.Replace(realm, ":", "-", -1) + "-*.json.gz"
-	log.Printf("scan by mask %s ...", mask)
+	prc.Log.Printf("scan by mask %s ...", mask)
 	fnames, err := filepath.Glob(mask)
 	if err != nil {
-		log.Fatalln("glob failed:", err)
+		prc.Log.Fatalln("glob failed:", err)
 	}
-	log.Printf("... %d entries collected", len(fnames))
+	prc.Log.Printf("... %d entries collected", len(fnames))
 
 	var goodfnames []string
 
 	for _, fname := range fnames {
 		// realm, ts, good := util.Parse_FName(fname)
-		_, _, good := util.Parse_FName(fname)
+		_, _, good := util.Parse_AnyFName(fname)
 		if good {
 			// log.Printf("fname %s -> %s, %v", fname, realm, ts)
 			goodfnames = append(goodfnames, fname)
@@ -59,59 +62,37 @@ func ParseDir(cf *config.Config, realm string, safe bool) {
 		}
 	}
 	sort.Sort(util.ByBasename(goodfnames))
-	prc := new(AuctionProcessor)
-	prc.Init(cf, realm)
 	prc.LoadState()
+	prc.OpenJournal()
+	defer prc.CloseJournal()
 	badfiles := make(map[string]string)
 
-	for _, fname := range fnames {
-		//log.Println(fname)
-		f_realm, f_time, ok := util.Parse_FName(fname)
-		if !ok {
-			log.Fatalf("not parsed correctly: %s", fname)
-			continue
-		}
+	var files []snapshotFile
+	for _, fname := range goodfnames {
+		f_realm, f_time, _ := util.Parse_AnyFName(fname)
 		if f_realm != realm {
-			log.Fatalf("not my realm (%s != %s)", f_realm, realm)
+			prc.Log.Fatalf("not my realm (%s != %s)", f_realm, realm)
 			continue
 		}
 		if !prc.SnapshotNeeded(f_time) {
-			log.Printf("snapshot not needed: %s", util.TSStr(f_time))
-			continue
-		}
-		data, err := util.Load(fname)
-		if err != nil {
-			//log.Fatalf("load error: %s", err)
-			log.Printf("%s LOAD ERROR: %s", fname, err)
-			badfiles[fname] = fmt.Sprint(err)
-			continue
-		}
-		ss, err := ParseSnapshot(data)
-		if err != nil {
-			//log.Fatalf("load error: %s", err)
-			log.Printf("%s PARSE ERROR: %s", fname, err)
-			badfiles[fname] = fmt.Sprint(err)
 			continue
 		}
-
-		prc.StartSnapshot(f_time)
-		for _, auc := range ss.Auctions {
-			prc.AddAuctionEntry(&auc)
-		}
-		prc.FinishSnapshot()
-		if safe {
-			prc.SaveState()
-		}
+		files = append(files, snapshotFile{fname, f_time})
 	}
+	prc.Log.Printf("... %d snapshots to process", len(files))
+
+	stats := run_pipeline(prc, files, safe, badfiles)
+
 	if !safe {
 		prc.SaveState()
 	}
 	if len(badfiles) == 0 {
-		log.Printf("all files loaded without errors")
+		prc.Log.Printf("all files loaded without errors")
 	} else {
-		log.Printf("%d files with errors", len(badfiles))
+		prc.Log.Printf("%d files with errors", len(badfiles))
 		for fname, err := range badfiles {
-			log.Printf("%s: %s", fname, err)
+			prc.Log.Printf("%s: %s", fname, err)
 		}
 	}
+	return stats
 }
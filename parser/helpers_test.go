@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const testRealm = "eu:test"
+
+func testConfig(t *testing.T) *config.Config {
+	cf := config.Default(t.TempDir())
+	util.CheckDir(cf.DownloadDirectory)
+	util.CheckDir(cf.TempDirectory)
+	util.CheckDir(cf.ResultDirectory)
+	return cf
+}
+
+var testStart = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// время i-го снимка: раз в час
+func snapTime(i int) time.Time {
+	return testStart.Add(time.Duration(i) * time.Hour)
+}
+
+// дамп в старом формате: лоты с номерами из ids
+func legacyDump(ids ...int64) string {
+	var aucs []string
+	for _, id := range ids {
+		aucs = append(aucs, fmt.Sprintf(
+			`{"auc":%d,"item":%d,"owner":"Seller%d","ownerRealm":"Test",`+
+				`"bid":100,"buyout":200,"quantity":1,"timeLeft":"VERY_LONG"}`,
+			id, 1000+id%5, id%3))
+	}
+	return `{"realms":[{"name":"Test","slug":"test"}],"auctions":[` +
+		strings.Join(aucs, ",") + `]}`
+}
+
+// положить дамп i-го снимка в DownloadDirectory
+func writeDump(t *testing.T, cf *config.Config, i int, data string) string {
+	fname := cf.DownloadDirectory + util.Make_FName(testRealm, snapTime(i), true)
+	if err := util.Store(fname, util.Zip([]byte(data))); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func resultName(cf *config.Config, name string) string {
+	return cf.ResultDirectory + cf.GetTimedName(name, testRealm, testStart)
+}
+
+func readLines(t *testing.T, fname string) []string {
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// содержимое всех результатов реалма: имя -> строки
+func readResults(t *testing.T, cf *config.Config) map[string][]string {
+	res := make(map[string][]string)
+	for _, name := range []string{"auctions", "metadata", "snapshot", "prices", "sales", "sellers"} {
+		res[name] = readLines(t, resultName(cf, name))
+	}
+	return res
+}
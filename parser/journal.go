@@ -0,0 +1,231 @@
+package parser
+
+// журнал снимков реалма ({realm}-journal в ResultDirectory).
+// перед снимком пишется "begin" с размерами выходных файлов до него,
+// после - "commit" с размерами после; обе записи сразу сбрасываются
+// на диск. SaveState (контрольная точка) журнал очищает.
+// при старте (OpenJournal):
+//   - незакоммиченный снимок откатывается: выходные файлы обрезаются
+//     до размеров из его "begin";
+//   - закоммиченные снимки новее состояния переигрываются из их дампов
+//     без записи результатов, так что разбор продолжается ровно с
+//     последнего закоммиченного снимка;
+//   - если дамп переиграть нельзя, выходные файлы обрезаются до начала
+//     этого снимка, и он вместе с последующими будет разобран заново.
+// тем же путём откатывается снимок с битым дампом (AbortSnapshot)
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const (
+	J_BEGIN  = "begin"
+	J_COMMIT = "commit"
+)
+
+type journalRecord struct {
+	Op     string           `json:"op"`
+	Time   time.Time        `json:"time"`
+	Source string           `json:"source,omitempty"` // дамп снимка
+	Files  map[string]int64 `json:"files"`            // размеры файлов, -1 - файла нет
+}
+
+// размеры файлов (-1 для отсутствующих)
+func fileSizes(fnames []string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, fname := range fnames {
+		sizes[fname] = -1
+		if fi, err := os.Stat(fname); err == nil {
+			sizes[fname] = fi.Size()
+		}
+	}
+	return sizes
+}
+
+// вернуть файлы к записанным размерам
+func (prc *AuctionProcessor) truncateFiles(sizes map[string]int64) {
+	for fname, size := range sizes {
+		var err error
+		if size < 0 {
+			err = os.Remove(fname)
+		} else if util.CheckFile(fname) {
+			err = os.Truncate(fname, size)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			prc.Log.Panicf("journal: truncate %s to %d failed: %s", fname, size, err)
+		}
+		prc.Log.Printf("journal: %s rolled back to %d bytes", fname, size)
+	}
+}
+
+func (prc *AuctionProcessor) readJournal() (records []journalRecord) {
+	data, err := ioutil.ReadFile(prc.JournalFName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			prc.Log.Panicf("journal: %s", err)
+		}
+		return nil
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var r journalRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			// недописанная последняя строка: упали прямо во время записи
+			prc.Log.Printf("journal: skip broken record: %s", err)
+			break
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// переиграть закоммиченный снимок из дампа, ничего не записывая.
+// при ошибке состояние в памяти уже испорчено: его надо перечитать
+func (prc *AuctionProcessor) replay(source string, ts time.Time) error {
+	stream, err := OpenAuctionStream(source)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	prc.Replaying = true
+	defer func() { prc.Replaying = false }()
+	prc.StartSnapshot(ts)
+	var auc Auction
+	for stream.Next(&auc) {
+		prc.AddAuctionEntry(&auc)
+	}
+	if err = stream.Err(); err != nil {
+		prc.Started = false
+		return err
+	}
+	prc.FinishSnapshot()
+	return nil
+}
+
+// восстановиться по журналу после падения и открыть его для записи.
+// вызывать после LoadState
+func (prc *AuctionProcessor) OpenJournal() {
+	records := prc.readJournal()
+	var committed [][2]journalRecord // пары begin/commit
+	var pending *journalRecord
+	for i := range records {
+		r := &records[i]
+		switch {
+		case r.Op == J_BEGIN:
+			pending = r
+		case r.Op == J_COMMIT && pending != nil && pending.Time.Equal(r.Time):
+			committed = append(committed, [2]journalRecord{*pending, *r})
+			pending = nil
+		}
+	}
+	dirty := false
+	if pending != nil {
+		prc.Log.Printf("journal: snapshot %s was not committed, rolling back", util.TSStr(pending.Time))
+		prc.truncateFiles(pending.Files)
+	}
+	for replayed := false; !replayed; {
+		replayed = true
+		for i, c := range committed {
+			if !c[0].Time.After(prc.State.LastTime) {
+				continue // уже в состоянии
+			}
+			prc.Log.Printf("journal: replaying committed snapshot %s", util.TSStr(c[0].Time))
+			dirty = true
+			if err := prc.replay(c[0].Source, c[0].Time); err != nil {
+				prc.Log.Printf("journal: replay of %s failed (%s), will be parsed again", c[0].Source, err)
+				// вернуть файлы к состоянию до этого снимка
+				rollback := make(map[string]int64)
+				for _, rest := range committed[i:] {
+					for fname, size := range rest[0].Files {
+						if _, ok := rollback[fname]; !ok {
+							rollback[fname] = size
+						}
+					}
+				}
+				prc.truncateFiles(rollback)
+				// состояние испорчено недоигранным снимком: перечитать
+				// и переиграть заново всё, что было до него
+				committed = committed[:i]
+				prc.LoadState()
+				replayed = false
+				break
+			}
+		}
+	}
+	if dirty {
+		prc.SaveState() // контрольная точка: журнал дальше не нужен
+	}
+	f, err := os.OpenFile(prc.JournalFName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		prc.Log.Panicf("journal: %s", err)
+	}
+	prc.journal = f
+}
+
+// откатить начатый снимок, когда его дамп оказался битым посреди
+// разбора. в файлы до FinishSnapshot ничего не пишется, а вот лоты в
+// памяти уже изменены: состояние перечитывается и доигрывается по
+// журналу, а begin этого снимка остаётся в нём незакоммиченным
+func (prc *AuctionProcessor) AbortSnapshot() {
+	prc.Log.Printf("journal: snapshot %s aborted", util.TSStr(prc.SnapshotTime))
+	prc.Started = false
+	prc.CloseJournal()
+	prc.LoadState()
+	prc.OpenJournal()
+}
+
+func (prc *AuctionProcessor) CloseJournal() {
+	if prc.journal != nil {
+		prc.journal.Close()
+		prc.journal = nil
+	}
+}
+
+func (prc *AuctionProcessor) writeJournal(r *journalRecord) {
+	if prc.journal == nil || prc.Replaying {
+		return
+	}
+	data, _ := json.Marshal(r)
+	if _, err := prc.journal.Write(append(data, '\n')); err != nil {
+		prc.Log.Panicf("journal: write failed: %s", err)
+	}
+	if err := prc.journal.Sync(); err != nil {
+		prc.Log.Panicf("journal: sync failed: %s", err)
+	}
+}
+
+// контрольная точка: состояние сохранено, журнал начинается заново
+func (prc *AuctionProcessor) resetJournal() {
+	if prc.journal == nil {
+		return
+	}
+	if err := prc.journal.Truncate(0); err != nil {
+		prc.Log.Panicf("journal: truncate failed: %s", err)
+	}
+	prc.journal.Sync()
+}
+
+func (prc *AuctionProcessor) journalBegin() {
+	prc.writeJournal(&journalRecord{
+		Op:     J_BEGIN,
+		Time:   prc.SnapshotTime,
+		Source: prc.Source,
+		Files:  fileSizes(prc.outputNames()),
+	})
+}
+
+func (prc *AuctionProcessor) journalCommit() {
+	prc.writeJournal(&journalRecord{
+		Op:    J_COMMIT,
+		Time:  prc.SnapshotTime,
+		Files: fileSizes(prc.outputNames()),
+	})
+}
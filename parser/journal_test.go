@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	config "github.com/gourytch/gowowuction/config"
+)
+
+var journalDumps = []string{
+	legacyDump(1, 2, 3),
+	legacyDump(2, 3, 4),
+	legacyDump(3, 4, 5),
+	legacyDump(4, 5, 6),
+}
+
+// результаты без учёта порядка: закрытые лоты одного снимка
+// пишутся в порядке обхода map
+func sortedResults(t *testing.T, cf *config.Config) map[string][]string {
+	res := readResults(t, cf)
+	for _, lines := range res {
+		sort.Strings(lines)
+	}
+	return res
+}
+
+// чистый прогон по снимкам steps - эталон для сравнения
+func cleanResults(t *testing.T, steps ...int) map[string][]string {
+	cf := testConfig(t)
+	for _, i := range steps {
+		writeDump(t, cf, i, journalDumps[i])
+	}
+	ParseDir(cf, testRealm, false)
+	return sortedResults(t, cf)
+}
+
+// начать процессор так же, как ParseDir
+func openProcessor(cf *config.Config) *AuctionProcessor {
+	prc := new(AuctionProcessor)
+	prc.Init(cf, testRealm)
+	prc.LoadState()
+	prc.OpenJournal()
+	return prc
+}
+
+// разобрать i-й снимок, как это делает task_processor
+func feedSnapshot(t *testing.T, prc *AuctionProcessor, fname string, i int) {
+	stream, err := OpenAuctionStream(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	prc.Source = fname
+	prc.StartSnapshot(snapTime(i))
+	var auc Auction
+	for stream.Next(&auc) {
+		prc.AddAuctionEntry(&auc)
+	}
+	if err = stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	prc.FinishSnapshot()
+}
+
+// снимки 0 и 1 разобраны и сохранены, снимки 2 и 3 закоммичены в
+// журнале, но до SaveState дело не дошло
+func crashAfterCommit(t *testing.T) (*config.Config, []string) {
+	cf := testConfig(t)
+	var fnames []string
+	for i, data := range journalDumps {
+		fnames = append(fnames, writeDump(t, cf, i, data))
+	}
+	os.Rename(fnames[2], fnames[2]+".hidden")
+	os.Rename(fnames[3], fnames[3]+".hidden")
+	ParseDir(cf, testRealm, false)
+	os.Rename(fnames[2]+".hidden", fnames[2])
+	os.Rename(fnames[3]+".hidden", fnames[3])
+
+	prc := openProcessor(cf)
+	feedSnapshot(t, prc, fnames[2], 2)
+	feedSnapshot(t, prc, fnames[3], 3)
+	prc.CloseJournal()
+	return cf, fnames
+}
+
+// упали посреди снимка: выходные файлы откатываются к его началу,
+// снимок разбирается заново
+func TestJournalRollback(t *testing.T) {
+	want := cleanResults(t, 0, 1, 2)
+
+	cf := testConfig(t)
+	writeDump(t, cf, 0, journalDumps[0])
+	writeDump(t, cf, 1, journalDumps[1])
+	ParseDir(cf, testRealm, false)
+
+	fname := writeDump(t, cf, 2, journalDumps[2])
+	prc := openProcessor(cf)
+	prc.Source = fname
+	prc.StartSnapshot(snapTime(2))
+	for _, name := range prc.outputNames() {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("half-written garbage\n")
+		f.Close()
+	}
+	prc.CloseJournal()
+
+	st := ParseDir(cf, testRealm, false)
+	if st.Process.Files != 1 {
+		t.Errorf("%d snapshots parsed, want 1", st.Process.Files)
+	}
+	if got := sortedResults(t, cf); !reflect.DeepEqual(got, want) {
+		t.Errorf("results after rollback:\n got  %q\n want %q", got, want)
+	}
+}
+
+// закоммиченные снимки новее состояния переигрываются без записи
+func TestJournalReplay(t *testing.T) {
+	want := cleanResults(t, 0, 1, 2, 3)
+
+	cf, _ := crashAfterCommit(t)
+	before := sortedResults(t, cf)
+	if !reflect.DeepEqual(before, want) {
+		t.Fatalf("results before replay:\n got  %q\n want %q", before, want)
+	}
+	st := ParseDir(cf, testRealm, false)
+	if st.Process.Files != 0 {
+		t.Errorf("%d snapshots parsed again", st.Process.Files)
+	}
+	if got := sortedResults(t, cf); !reflect.DeepEqual(got, want) {
+		t.Errorf("replay changed results:\n got  %q\n want %q", got, want)
+	}
+	prc := new(AuctionProcessor)
+	prc.Init(cf, testRealm)
+	prc.LoadState()
+	if !prc.State.LastTime.Equal(snapTime(3)) {
+		t.Errorf("state time %s after replay, want %s", prc.State.LastTime, snapTime(3))
+	}
+}
+
+// дамп закоммиченного снимка пропал: файлы обрезаются до его начала,
+// оставшиеся снимки разбираются заново
+func TestJournalReplayFailed(t *testing.T) {
+	want := cleanResults(t, 0, 1, 3)
+
+	cf, fnames := crashAfterCommit(t)
+	if err := os.Remove(fnames[2]); err != nil {
+		t.Fatal(err)
+	}
+	st := ParseDir(cf, testRealm, false)
+	if st.Process.Files != 1 {
+		t.Errorf("%d snapshots parsed, want 1", st.Process.Files)
+	}
+	if got := sortedResults(t, cf); !reflect.DeepEqual(got, want) {
+		t.Errorf("results after failed replay:\n got  %q\n want %q", got, want)
+	}
+}
+
+// дамп закоммиченного снимка испортился: переигровка обрывается на
+// середине, состояние перечитывается, снимки до него доигрываются
+func TestJournalReplayBroken(t *testing.T) {
+	want := cleanResults(t, 0, 1, 3)
+
+	cf, _ := crashAfterCommit(t)
+	broken := journalDumps[2][:len(journalDumps[2])-2] + `,{"auc":9,"quantity":"x"}]}`
+	writeDump(t, cf, 2, broken)
+	st := ParseDir(cf, testRealm, false)
+	if st.Process.Files != 1 { // только 3: битый 2 отброшен
+		t.Errorf("%d snapshots parsed, want 1", st.Process.Files)
+	}
+	if got := sortedResults(t, cf); !reflect.DeepEqual(got, want) {
+		t.Errorf("results after broken replay:\n got  %q\n want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package parser
+
+// рыночная цена предмета: устойчивая цена снимка (ItemPrice.Market),
+// усреднённая по снимкам за окно в несколько дней до заданного момента.
+// источник - помесячные файлы "prices" (см. prices.go)
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type MarketValue struct {
+	ItemKey
+	Value     int64      `json:"value"`     // медь за штуку
+	Snapshots int        `json:"snapshots"` // снимков в окне, где предмет был с выкупом
+	Last      time.Time  `json:"last"`      // последний снимок с предметом
+	LastMin   int64      `json:"lastMin"`   // минимальный выкуп в нём
+	Daily     []DayValue `json:"daily,omitempty"`
+}
+
+type DayValue struct {
+	Day   time.Time `json:"day"`
+	Value int64     `json:"value"`
+}
+
+// прочитать цены реалма за [from, to] из помесячных файлов
+func LoadPrices(cf *config.Config, realm string, from, to time.Time, fn func(p *ItemPrice)) error {
+	return readMonthly(cf, "prices", realm, from, to, func(line []byte) error {
+		var p ItemPrice
+		if err := json.Unmarshal(line, &p); err != nil {
+			return err
+		}
+		if !p.Time.Before(from) && !p.Time.After(to) {
+			fn(&p)
+		}
+		return nil
+	})
+}
+
+type marketAccum struct {
+	mv   MarketValue
+	sum  int64
+	days map[time.Time][2]int64 // день -> сумма, число снимков
+}
+
+// рыночные цены всех предметов (или одного, если only != nil)
+// по снимкам за window до момента at
+func MarketValues(cf *config.Config, realm string, at time.Time, window time.Duration,
+	only *ItemKey) (map[ItemKey]*MarketValue, error) {
+	acc := make(map[ItemKey]*marketAccum)
+	err := LoadPrices(cf, realm, at.Add(-window), at, func(p *ItemPrice) {
+		if p.Market == 0 || (only != nil && p.ItemKey != *only) {
+			return
+		}
+		a := acc[p.ItemKey]
+		if a == nil {
+			a = &marketAccum{mv: MarketValue{ItemKey: p.ItemKey}}
+			if only != nil {
+				a.days = make(map[time.Time][2]int64)
+			}
+			acc[p.ItemKey] = a
+		}
+		a.sum += p.Market
+		a.mv.Snapshots++
+		if !p.Time.Before(a.mv.Last) {
+			a.mv.Last = p.Time
+			a.mv.LastMin = p.Min
+		}
+		if a.days != nil {
+			day := p.Time.Truncate(24 * time.Hour)
+			d := a.days[day]
+			a.days[day] = [2]int64{d[0] + p.Market, d[1] + 1}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[ItemKey]*MarketValue)
+	for key, a := range acc {
+		a.mv.Value = util.PerUnit(a.sum, int64(a.mv.Snapshots))
+		for day, d := range a.days {
+			a.mv.Daily = append(a.mv.Daily, DayValue{day, util.PerUnit(d[0], d[1])})
+		}
+		sort.Slice(a.mv.Daily, func(i, j int) bool { return a.mv.Daily[i].Day.Before(a.mv.Daily[j].Day) })
+		values[key] = &a.mv
+	}
+	return values, nil
+}
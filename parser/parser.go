@@ -22,6 +22,30 @@ func ParseAuction(data *RawAuctionData) (r *Auction) {
 }
 */
 
+// привести аукцион нового API к старому виду.
+// владельца новый API не отдаёт, ставка за лот - unit_price * quantity
+func ConvertModernAuction(m *ModernAuction) (auc Auction) {
+	auc.Auc = m.Id
+	auc.Item = m.Item.Id
+	auc.Bid = m.Bid
+	auc.Buyout = m.Buyout
+	if auc.Buyout == 0 && m.UnitPrice != 0 {
+		auc.Buyout = m.UnitPrice * int64(m.Quantity)
+	}
+	auc.Quantity = m.Quantity
+	auc.TimeLeft = m.TimeLeft
+	auc.Context = m.Item.Context
+	for _, id := range m.Item.BonusLists {
+		auc.BonusLists = append(auc.BonusLists, Bonus{id})
+	}
+	auc.Modifiers = m.Item.Modifiers
+	auc.PetSpeciesId = m.Item.PetSpeciesId
+	auc.PetBreedId = m.Item.PetBreedId
+	auc.PetLevel = m.Item.PetLevel
+	auc.PetQualityId = m.Item.PetQualityId
+	return
+}
+
 func ParseSnapshot(data []byte) (snapshot *SnapshotData, err error) {
 	snapshot = new(SnapshotData)
 	err = json.Unmarshal(data, snapshot)
@@ -1,9 +1,263 @@
 package parser
 
-func do_load() {
+// конвейер разбора снимков одного реалма:
+//   do_verify      - быстро проверяет файлы с опережением, не распаковывая
+//                    (см. checkDump)
+//   do_decode      - потоком разбирает файл в пачки лотов; каждый дамп
+//                    распаковывается и разбирается ровно один раз
+//   task_processor - единственный потребитель: скармливает лоты
+//                    AuctionProcessor строго в порядке времени снимков.
+//                    если дамп оказался битым посреди разбора, снимок
+//                    откатывается по журналу (AbortSnapshot)
+// дампы целиком в память не читаются: одновременно в ней не больше
+// BATCH_AHEAD пачек лотов
 
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const (
+	VERIFY_AHEAD = 2    // проверенных файлов в очереди к разбору
+	BATCH_SIZE   = 4096 // лотов в пачке
+	BATCH_AHEAD  = 4    // пачек в очереди к процессору
+)
+
+type snapshotFile struct {
+	fname string
+	ts    time.Time
+}
+
+type checkedFile struct {
+	snapshotFile
+	err error // файл битый: ни один лот из него не попадёт в процессор
+}
+
+type decodedFile struct {
+	snapshotFile
+	batches chan []Auction
+	badErr  error // файл битый или не открылся: пачек не будет
+	err     error // ошибка разбора, читать только после close(batches);
+	// часть лотов к этому времени уже ушла в процессор
+}
+
+type StageStats struct {
+	Files    int
+	BytesIn  int64
+	BytesOut int64
+	Items    int // лотов
+	Busy     time.Duration
+}
+
+func (st *StageStats) add(other *StageStats) {
+	st.Files += other.Files
+	st.BytesIn += other.BytesIn
+	st.BytesOut += other.BytesOut
+	st.Items += other.Items
+	st.Busy += other.Busy
+}
+
+type PipelineStats struct {
+	Verify  StageStats
+	Decode  StageStats
+	Process StageStats
+	Wall    time.Duration
 }
 
-func task_processor() {
+func (ps *PipelineStats) Add(other *PipelineStats) {
+	ps.Verify.add(&other.Verify)
+	ps.Decode.add(&other.Decode)
+	ps.Process.add(&other.Process)
+	ps.Wall += other.Wall
+}
+
+func rate(x float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return x / d.Seconds()
+}
+
+func (ps *PipelineStats) Print() {
+	const MB = 1024 * 1024
+	log.Printf("pipeline stats (busy time / throughput while busy):")
+	log.Printf("  verify : %4d files in %s", ps.Verify.Files, ps.Verify.Busy)
+	log.Printf("  decode : %4d files, %8d auctions in %s, %6.1f MB/s, %8.0f auc/s",
+		ps.Decode.Files, ps.Decode.Items, ps.Decode.Busy,
+		rate(float64(ps.Decode.BytesIn)/MB, ps.Decode.Busy), rate(float64(ps.Decode.Items), ps.Decode.Busy))
+	log.Printf("  process: %4d files, %8d auctions in %s, %8.0f auc/s",
+		ps.Process.Files, ps.Process.Items, ps.Process.Busy, rate(float64(ps.Process.Items), ps.Process.Busy))
+	log.Printf("  wall time %s", ps.Wall)
+}
+
+// быстрая проверка дампа до разбора: полностью дамп проверяется ещё
+// при сохранении (util.Store), здесь ловятся только явно негодные
+// файлы. несовпадение схемы и порчу содержимого находит сам разбор
+func checkDump(fname string) error {
+	if strings.HasSuffix(fname, ".gz") {
+		return util.CheckGzip(fname)
+	}
+	return nil
+}
+
+// проверять файлы по порядку (см. checkDump)
+func do_verify(files []snapshotFile, out chan<- *checkedFile, done <-chan struct{}, st *StageStats) {
+	defer close(out)
+	for _, sf := range files {
+		if util.StopRequested() {
+			return
+		}
+		t0 := time.Now()
+		cf := &checkedFile{snapshotFile: sf}
+		cf.err = checkDump(sf.fname)
+		st.Files++
+		st.Busy += time.Since(t0)
+		select {
+		case out <- cf:
+		case <-done:
+			return
+		}
+	}
+}
+
+// разбирать проверенные файлы в пачки лотов. файл отдаётся потребителю
+// сразу, а пачки идут следом через его собственный канал
+func do_decode(in <-chan *checkedFile, out chan<- *decodedFile, done <-chan struct{}, st *StageStats) {
+	defer close(out)
+	for cf := range in {
+		df := &decodedFile{snapshotFile: cf.snapshotFile, badErr: cf.err}
+		var stream *AuctionStream
+		if df.badErr == nil {
+			stream, df.badErr = OpenAuctionStream(cf.fname)
+		}
+		if df.badErr == nil {
+			df.batches = make(chan []Auction, BATCH_AHEAD)
+		}
+		select {
+		case out <- df:
+		case <-done:
+			if stream != nil {
+				stream.Close()
+			}
+			return
+		}
+		if df.badErr != nil {
+			continue
+		}
+		t0 := time.Now()
+		st.Files++
+		if fi, err := os.Stat(cf.fname); err == nil {
+			st.BytesIn += fi.Size()
+		}
+		batch := make([]Auction, 0, BATCH_SIZE)
+		for {
+			batch = batch[:len(batch)+1]
+			if !stream.Next(&batch[len(batch)-1]) {
+				batch = batch[:len(batch)-1]
+				break
+			}
+			if len(batch) == BATCH_SIZE {
+				st.Busy += time.Since(t0)
+				select {
+				case df.batches <- batch:
+				case <-done:
+					stream.Close()
+					return
+				}
+				t0 = time.Now()
+				batch = make([]Auction, 0, BATCH_SIZE)
+			}
+		}
+		st.Items += stream.Count
+		st.Busy += time.Since(t0)
+		df.err = stream.Err()
+		stream.Close()
+		if len(batch) > 0 {
+			select {
+			case df.batches <- batch:
+			case <-done:
+				return
+			}
+		}
+		close(df.batches)
+	}
+}
+
+// единственный потребитель: снимки в процессор строго по порядку.
+// badfiles - файлы, отброшенные целиком
+func task_processor(prc *AuctionProcessor, in <-chan *decodedFile, safe bool,
+	badfiles map[string]string, st *StageStats) {
+	for df := range in {
+		if util.StopRequested() {
+			prc.Log.Printf("stop requested, rest of snapshots left for next run")
+			return
+		}
+		if df.badErr != nil {
+			prc.Log.Printf("%s LOAD ERROR: %s", df.fname, df.badErr)
+			badfiles[df.fname] = fmt.Sprint(df.badErr)
+			continue
+		}
+		if !prc.SnapshotNeeded(df.ts) {
+			prc.Log.Printf("snapshot not needed: %s", util.TSStr(df.ts))
+			for range df.batches {
+			}
+			continue
+		}
+		prc.Source = df.fname
+		prc.StartSnapshot(df.ts)
+		for batch := range df.batches { // ожидание пачек в Busy не входит
+			t0 := time.Now()
+			for i := range batch {
+				prc.AddAuctionEntry(&batch[i])
+			}
+			st.Items += len(batch)
+			st.Busy += time.Since(t0)
+		}
+		t0 := time.Now()
+		if df.err != nil {
+			// часть лотов уже применена: откатить снимок целиком
+			prc.Log.Printf("%s PARSE ERROR: %s", df.fname, df.err)
+			badfiles[df.fname] = fmt.Sprint(df.err)
+			prc.AbortSnapshot()
+			st.Busy += time.Since(t0)
+			continue
+		}
+		prc.FinishSnapshot()
+		if safe {
+			prc.SaveState()
+		}
+		st.Files++
+		st.Busy += time.Since(t0)
+	}
+}
 
+// прогнать файлы через конвейер. files отсортированы по времени
+func run_pipeline(prc *AuctionProcessor, files []snapshotFile, safe bool,
+	badfiles map[string]string) *PipelineStats {
+	ps := new(PipelineStats)
+	t0 := time.Now()
+	done := make(chan struct{})
+	checked := make(chan *checkedFile, VERIFY_AHEAD)
+	decoded := make(chan *decodedFile)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		do_verify(files, checked, done, &ps.Verify)
+	}()
+	go func() {
+		defer wg.Done()
+		do_decode(checked, decoded, done, &ps.Decode)
+	}()
+	task_processor(prc, decoded, safe, badfiles, &ps.Process)
+	close(done) // потребитель мог выйти раньше: отпустить стадии
+	wg.Wait()
+	ps.Wall = time.Since(t0)
+	return ps
 }
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+func TestParseDir(t *testing.T) {
+	cf := testConfig(t)
+	writeDump(t, cf, 0, legacyDump(1, 2, 3))
+	writeDump(t, cf, 1, legacyDump(2, 3, 4))
+	writeDump(t, cf, 2, legacyDump(3, 4, 5))
+	st := ParseDir(cf, testRealm, false)
+	if st.Verify.Files != 3 || st.Process.Files != 3 || st.Process.Items != 9 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+	res := readResults(t, cf)
+	if n := len(res["snapshot"]); n != 3 {
+		t.Errorf("%d snapshot lines, want 3", n)
+	}
+	if n := len(res["metadata"]); n != 2 { // закрылись 1 и 2
+		t.Errorf("%d closed auctions, want 2", n)
+	}
+
+	// второй прогон: всё уже разобрано
+	st = ParseDir(cf, testRealm, false)
+	if st.Process.Files != 0 {
+		t.Errorf("%d snapshots parsed again", st.Process.Files)
+	}
+}
+
+// дамп с верным JSON, но неверной схемой отбрасывается целиком,
+// остальные разбираются
+func TestParseDirBadSchema(t *testing.T) {
+	cf := testConfig(t)
+	writeDump(t, cf, 0, legacyDump(1, 2, 3))
+	writeDump(t, cf, 1, `{"auctions":[{"auc":2,"quantity":"x"}]}`)
+	writeDump(t, cf, 2, legacyDump(2, 3, 4))
+	st := ParseDir(cf, testRealm, false)
+	if st.Verify.Files != 3 || st.Process.Files != 2 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+	res := readResults(t, cf)
+	if n := len(res["snapshot"]); n != 2 {
+		t.Errorf("%d snapshot lines, want 2", n)
+	}
+	if n := len(res["metadata"]); n != 1 { // закрылся только 1
+		t.Errorf("%d closed auctions, want 1", n)
+	}
+}
+
+func TestCheckDump(t *testing.T) {
+	cf := testConfig(t)
+	good := writeDump(t, cf, 0, legacyDump(1, 2, 3))
+	if err := checkDump(good); err != nil {
+		t.Errorf("good dump: %s", err)
+	}
+	bad := map[string][]byte{
+		"empty":    nil,
+		"not gzip": []byte(legacyDump(1, 2, 3)),
+		"no data":  util.Zip(nil),
+	}
+	for name, data := range bad {
+		fname := cf.DownloadDirectory + name + ".json.gz"
+		if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkDump(fname); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+}
+
+// дамп, битый после нескольких верных лотов: применённые лоты
+// откатываются, остальные снимки разбираются как без него
+func TestParseDirBrokenMidway(t *testing.T) {
+	broken := legacyDump(2, 3, 7, 8)
+	broken = broken[:len(broken)-2] + `,{"auc":9,"quantity":"x"}]}`
+	for _, safe := range []bool{false, true} {
+		want := cleanResults(t, 0, 1, 3)
+		cf := testConfig(t)
+		writeDump(t, cf, 0, journalDumps[0])
+		writeDump(t, cf, 1, journalDumps[1])
+		writeDump(t, cf, 2, broken)
+		writeDump(t, cf, 3, journalDumps[3])
+		st := ParseDir(cf, testRealm, safe)
+		if st.Process.Files != 3 {
+			t.Errorf("safe=%v: %d snapshots parsed, want 3", safe, st.Process.Files)
+		}
+		if got := sortedResults(t, cf); !reflect.DeepEqual(got, want) {
+			t.Errorf("safe=%v: results:\n got  %q\n want %q", safe, got, want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package parser
+
+// цены по предметам на момент снимка: по всем открытым лотам реалма.
+// цены в меди за штуку; лоты без выкупа идут только в количество
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type ItemKey struct {
+	Item int64 `json:"item"`
+	Pet  int   `json:"pet,omitempty"` // petSpeciesId для клеток с питомцами
+}
+
+type ItemPrice struct {
+	Time time.Time `json:"time"`
+	ItemKey
+	Auctions int   `json:"auctions"`
+	Quantity int64 `json:"quantity"`
+	Sellers  int   `json:"sellers"` // 0, если API не отдаёт владельцев
+	Min      int64 `json:"min"`     // минимальный выкуп за штуку
+	Median   int64 `json:"median"`  // медиана выкупа за штуку (по штукам)
+	Mean     int64 `json:"mean"`    // средний выкуп за штуку, взвешенный по количеству
+	Market   int64 `json:"market"`  // то же без выбросов (см. MarketPrice)
+}
+
+type unitLot struct {
+	unit     int64
+	quantity int64
+}
+
+type itemAccum struct {
+	auctions int
+	quantity int64
+	sellers  map[string]bool
+	lots     []unitLot // только лоты с выкупом
+}
+
+func itemKey(auc *Auction) ItemKey {
+	return ItemKey{auc.Item, auc.PetSpeciesId}
+}
+
+// квантиль цены за штуку: каждая штука - отдельное наблюдение.
+// lots отсортированы по цене
+func weightedQuantile(lots []unitLot, total int64, q float64) int64 {
+	target := int64(math.Ceil(q * float64(total)))
+	if target < 1 {
+		target = 1
+	}
+	var n int64
+	for _, l := range lots {
+		n += l.quantity
+		if n >= target {
+			return l.unit
+		}
+	}
+	return 0
+}
+
+// устойчивая цена за штуку: средняя по количеству после отбрасывания
+// выбросов за пределами [Q1 - 1.5*IQR, Q3 + 1.5*IQR].
+// lots отсортированы по цене
+func MarketPrice(lots []unitLot, total int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	q1 := weightedQuantile(lots, total, 0.25)
+	q3 := weightedQuantile(lots, total, 0.75)
+	iqr := q3 - q1
+	lo, hi := q1-iqr*3/2, q3+iqr*3/2
+	var sum, units int64
+	for _, l := range lots {
+		if lo <= l.unit && l.unit <= hi {
+			sum += l.unit * l.quantity
+			units += l.quantity
+		}
+	}
+	return util.PerUnit(sum, units)
+}
+
+// собрать цены по открытым лотам
+func CollectPrices(ts time.Time, ws WorkSetType) []ItemPrice {
+	acc := make(map[ItemKey]*itemAccum)
+	for _, e := range ws {
+		auc := &e.Entry
+		key := itemKey(auc)
+		a := acc[key]
+		if a == nil {
+			a = &itemAccum{sellers: make(map[string]bool)}
+			acc[key] = a
+		}
+		a.auctions++
+		a.quantity += int64(auc.Quantity)
+		if auc.Owner != "" {
+			a.sellers[auc.Owner+"-"+auc.OwnerRealm] = true
+		}
+		if auc.Buyout > 0 && auc.Quantity > 0 {
+			a.lots = append(a.lots, unitLot{util.PerUnit(auc.Buyout, int64(auc.Quantity)), int64(auc.Quantity)})
+		}
+	}
+	prices := make([]ItemPrice, 0, len(acc))
+	for key, a := range acc {
+		p := ItemPrice{Time: ts, ItemKey: key,
+			Auctions: a.auctions, Quantity: a.quantity, Sellers: len(a.sellers)}
+		var sum, units int64
+		for _, l := range a.lots {
+			if p.Min == 0 || l.unit < p.Min {
+				p.Min = l.unit
+			}
+			sum += l.unit * l.quantity
+			units += l.quantity
+		}
+		if units > 0 {
+			sort.Slice(a.lots, func(i, j int) bool { return a.lots[i].unit < a.lots[j].unit })
+			p.Mean = util.PerUnit(sum, units)
+			p.Median = weightedQuantile(a.lots, units, 0.5)
+			p.Market = MarketPrice(a.lots, units)
+		}
+		prices = append(prices, p)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		if prices[i].Item != prices[j].Item {
+			return prices[i].Item < prices[j].Item
+		}
+		return prices[i].Pet < prices[j].Pet
+	})
+	return prices
+}
+
+func WritePrices(w io.Writer, prices []ItemPrice) error {
+	for i := range prices {
+		data, err := json.Marshal(&prices[i])
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+// лот: выкуп за весь лот и количество
+type testLot struct {
+	buyout   int64
+	quantity int32
+}
+
+func TestCollectPrices(t *testing.T) {
+	cases := []struct {
+		name string
+		lots []testLot
+		want ItemPrice // только цены, количество и число лотов
+	}{
+		{
+			// по лотам медиана была бы 11, по штукам - 20
+			name: "mixed stacks",
+			lots: []testLot{{10, 1}, {11, 1}, {200, 10}},
+			want: ItemPrice{Auctions: 3, Quantity: 12, Min: 10, Median: 20, Mean: 18, Market: 20},
+		},
+		{
+			// Q1 105, Q3 120: лот по 10000 за пределами Q3 + 1.5*IQR
+			name: "outlier",
+			lots: []testLot{{500, 5}, {525, 5}, {550, 5}, {600, 5}, {10000, 1}},
+			want: ItemPrice{Auctions: 5, Quantity: 21, Min: 100, Median: 110, Mean: 580, Market: 109},
+		},
+		{
+			name: "without buyout",
+			lots: []testLot{{0, 3}, {100, 2}},
+			want: ItemPrice{Auctions: 2, Quantity: 5, Min: 50, Median: 50, Mean: 50, Market: 50},
+		},
+		{
+			name: "only without buyout",
+			lots: []testLot{{0, 3}},
+			want: ItemPrice{Auctions: 1, Quantity: 3},
+		},
+		{
+			name: "single lot",
+			lots: []testLot{{308, 4}},
+			want: ItemPrice{Auctions: 1, Quantity: 4, Min: 77, Median: 77, Mean: 77, Market: 77},
+		},
+	}
+	for _, c := range cases {
+		ws := make(WorkSetType)
+		for i, l := range c.lots {
+			var e WorkEntry
+			e.Entry.Auc = int64(i + 1)
+			e.Entry.Item = 1000
+			e.Entry.Buyout = l.buyout
+			e.Entry.Quantity = l.quantity
+			ws[e.Entry.Auc] = e
+		}
+		prices := CollectPrices(testStart, ws)
+		if len(prices) != 1 {
+			t.Errorf("%s: %d prices, want 1", c.name, len(prices))
+			continue
+		}
+		got := prices[0]
+		got.Time, got.ItemKey, got.Sellers = time.Time{}, ItemKey{}, 0
+		if got != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
@@ -15,7 +15,9 @@ import (
 
 type AuctionState struct {
 	Created  time.Time `json:"created"`
-	DeadLine time.Time `json:"deadline"`
+	DeadLine time.Time `json:"deadline"`    // = Latest, для старых читателей
+	Earliest time.Time `json:"deadlineMin"` // окончание лота не раньше
+	Latest   time.Time `json:"deadlineMax"` // и не позже
 	Updated  time.Time `json:"updated"`
 	Raised   bool      `json:"raised"` // bid change detected
 	Moved    bool      `json:"moved"`  // player renamed / moved
@@ -24,11 +26,16 @@ type AuctionState struct {
 }
 
 type AuctionMeta struct {
-	Auc    int64     `json:"auc"`
-	Opened time.Time `json:"opened"`
-	Closed time.Time `json:"closed"`
-	Result string    `json:"result"`
-	Profit int64     `json:"profit"`
+	Auc        int64     `json:"auc"`
+	Opened     time.Time `json:"opened"`
+	Closed     time.Time `json:"closed"`
+	Result     string    `json:"result"`
+	Profit     int64     `json:"profit"`     // за весь лот
+	Confidence float64   `json:"confidence"` // вероятность того, что Result верен
+	Quantity   int32     `json:"quantity"`
+	UnitBuyout int64     `json:"unitBuyout"` // цены за штуку, в меди
+	UnitBid    int64     `json:"unitBid"`
+	UnitProfit int64     `json:"unitProfit"`
 }
 
 type WorkEntry struct {
@@ -49,12 +56,21 @@ type AuctionProcessorState struct {
 
 type AuctionProcessor struct {
 	cf           *config.Config
+	Log          *log.Logger // с префиксом реалма: реалмы разбираются параллельно
 	StateFName   string
+	OldStateName string // состояние в другом формате, подхватывается при смене формата
+	JournalFName string
+	journal      *os.File
+	Source       string // дамп текущего снимка, для журнала
+	Replaying    bool   // переигрывание по журналу: результаты уже записаны
 	Realm        string
 	State        AuctionProcessorState
 	SnapshotTime time.Time
 	Started      bool
 	SeenSet      IdSetType
+	sales        map[ItemKey]*ItemSales // продажи текущего снимка
+	sellers      map[string]*SellerActivity
+	lows         map[ItemKey]*itemLow // минимумы прошлого снимка, для подрезок
 	FileMeta     *os.File
 	FileAuc      *os.File
 	NumCreated   int
@@ -62,9 +78,13 @@ type AuctionProcessor struct {
 	NumBids      int
 	NumMoves     int
 	NumAdjusts   int
+	NumConflicts int
 	NumBought    int
 	NumAuctioned int
 	NumExpired   int
+	NumUnknown   int
+	Gap          time.Duration // пауза с прошлого снимка
+	GapThreshold time.Duration // пауза длиннее этой - пропуск снимков
 
 	TotalOpened  int
 	TotalClosed  int
@@ -78,6 +98,17 @@ const (
 	S_SHORT     = "SHORT"
 )
 
+const DEFAULT_GAP_THRESHOLD = 3 * time.Hour
+
+// априорные вероятности для исхода закрытия:
+// EARLY_CLOSE_PRIOR - что лот с выкупом снят раньше срока, хотя по времени
+// исчезновения мог и истечь; BUYOUT_SHARE - что снятый раньше срока лот
+// выкуплен, а не отозван продавцом (отзыв от выкупа не отличить)
+const (
+	EARLY_CLOSE_PRIOR = 0.04
+	BUYOUT_SHARE      = 0.9
+)
+
 func get_expiration_interval(exp string) (min, max time.Duration) {
 	switch {
 	case exp == S_SHORT: // "SHORT" -> 0 .. 30m
@@ -110,28 +141,41 @@ func guess_expiration(t time.Time, exp string) (min, max time.Time) {
 	return t.Add(dmin), t.Add(dmax)
 }
 
+// сузить интервал окончания лота по наблюдению timeLeft в момент t.
+// если интервалы не пересекаются (часы сервера, границы корзин),
+// верим последнему наблюдению
+func (prc *AuctionProcessor) narrowDeadLine(st *AuctionState, t time.Time, timeLeft string) {
+	dl_min, dl_max := guess_expiration(t, timeLeft)
+	if st.Latest.IsZero() { // первое наблюдение
+		st.Earliest, st.Latest = dl_min, dl_max
+	} else {
+		if dl_min.After(st.Earliest) {
+			st.Earliest = dl_min
+		}
+		if dl_max.Before(st.Latest) {
+			st.Latest = dl_max
+		}
+		if st.Latest.Before(st.Earliest) {
+			st.Earliest, st.Latest = dl_min, dl_max
+			prc.NumConflicts++
+		}
+	}
+	st.DeadLine = st.Latest
+	st.Updated = t
+}
+
 func (prc *AuctionProcessor) createEntry(auc *Auction) {
 	id := auc.Auc
 	var e WorkEntry
 	e.Entry = *auc
 	e.State.Created = prc.SnapshotTime
-	dl_min, _ := guess_expiration(prc.SnapshotTime, e.Entry.TimeLeft)
-	var zeroTime time.Time
-	if prc.State.LastTime == zeroTime { // zero value
-		e.State.DeadLine = dl_min
-	} else { // assigned
-		_, dl_max2 := guess_expiration(prc.State.LastTime, e.Entry.TimeLeft)
-		if dl_max2.Before(dl_min) {
-			e.State.DeadLine = dl_min
-		} else {
-			e.State.DeadLine = dl_max2
-		}
-	}
+	prc.narrowDeadLine(&e.State, prc.SnapshotTime, e.Entry.TimeLeft)
 	e.State.FirstBid = auc.Bid
 	e.State.LastBid = auc.Bid
 	prc.State.WorkSet[id] = e
 	prc.SeenSet[id] = false
 	prc.NumCreated++
+	prc.countPost(auc)
 }
 
 func (prc *AuctionProcessor) applyEntry(auc *Auction) {
@@ -147,10 +191,10 @@ func (prc *AuctionProcessor) applyEntry(auc *Auction) {
 	}
 	if auc.TimeLeft != e.Entry.TimeLeft {
 		e.Entry.TimeLeft = auc.TimeLeft
-		_, e.State.DeadLine = guess_expiration(prc.SnapshotTime, e.Entry.TimeLeft)
 		prc.NumAdjusts++
 		changed = true
 	}
+	prc.narrowDeadLine(&e.State, prc.SnapshotTime, auc.TimeLeft)
 	if auc.Owner != e.Entry.Owner || auc.OwnerRealm != e.Entry.OwnerRealm {
 		e.Entry.Owner = auc.Owner
 		e.Entry.OwnerRealm = auc.OwnerRealm
@@ -166,6 +210,36 @@ func (prc *AuctionProcessor) applyEntry(auc *Auction) {
 	}
 }
 
+// вероятность того, что лот исчез раньше своего срока, если исчез он
+// равномерно где-то в (gone_min, gone_max], а срок равномерно в [dl_min, dl_max]
+func early_probability(gone_min, gone_max, dl_min, dl_max time.Time) float64 {
+	const STEPS = 64
+	span := gone_max.Sub(gone_min)
+	width := dl_max.Sub(dl_min)
+	sum := 0.0
+	for i := 0; i < STEPS; i++ {
+		// середины отрезков разбиения (gone_min, gone_max]
+		x := gone_min.Add(span * time.Duration(2*i+1) / (2 * STEPS))
+		switch {
+		case !x.After(dl_min):
+			sum += 1
+		case !x.Before(dl_max):
+			sum += 0
+		default: // width > 0 here
+			sum += float64(dl_max.Sub(x)) / float64(width)
+		}
+	}
+	return sum / STEPS
+}
+
+// вероятность снятия раньше срока с учётом EARLY_CLOSE_PRIOR,
+// если p_early - она же только по времени исчезновения
+func early_posterior(p_early float64) float64 {
+	early := EARLY_CLOSE_PRIOR * p_early
+	late := (1 - EARLY_CLOSE_PRIOR) * (1 - p_early)
+	return early / (early + late)
+}
+
 func (prc *AuctionProcessor) closeEntry(id int64) {
 	e := prc.State.WorkSet[id]
 	delete(prc.State.WorkSet, id)
@@ -173,28 +247,64 @@ func (prc *AuctionProcessor) closeEntry(id int64) {
 	m.Auc = e.Entry.Auc
 	m.Opened = e.State.Created
 	m.Closed = prc.SnapshotTime
+	if prc.GapDetected() {
+		// за время пропуска могло случиться что угодно, не гадаем
+		m.Result = "unknown"
+		prc.NumUnknown++
+		prc.writeClosed(&e.Entry, &m)
+		return
+	}
+	// в прошлом снимке лот ещё был, в этом его уже нет
+	gone_min := prc.State.LastTime
+	if gone_min.IsZero() || gone_min.After(prc.SnapshotTime) {
+		gone_min = prc.SnapshotTime
+	}
+	p_early := early_probability(gone_min, prc.SnapshotTime, e.State.Earliest, e.State.Latest)
+	// по одному лишь времени исчезновения снятие раньше срока выглядит
+	// вероятнее, чем есть: учитываем априорную редкость
+	post_early := early_posterior(p_early)
+	// выкупить лот без цены выкупа нельзя, раньше срока такой можно
+	// только отозвать: тогда он не истёк, и уверенность в исходе низкая
+	p_bought := 0.0
+	if e.Entry.Buyout > 0 {
+		p_bought = post_early * BUYOUT_SHARE
+	}
 	switch {
-	case e.State.DeadLine.Before(prc.SnapshotTime):
+	case p_bought > 1-post_early:
 		m.Result = "bought"
 		m.Profit = e.Entry.Buyout
+		m.Confidence = p_bought
 		prc.NumBought++
 	case e.State.Raised:
 		m.Result = "auctioned"
 		m.Profit = e.State.LastBid
+		m.Confidence = 1 - post_early
 		prc.NumAuctioned++
 	default:
 		m.Result = "expired"
+		m.Confidence = 1 - post_early
 		prc.NumExpired++
 	}
-	data_auc, err := json.Marshal(e.Entry)
+	prc.writeClosed(&e.Entry, &m)
+}
+
+func (prc *AuctionProcessor) writeClosed(auc *Auction, m *AuctionMeta) {
+	q := int64(auc.Quantity)
+	m.Quantity = auc.Quantity
+	m.UnitBuyout = util.PerUnit(auc.Buyout, q)
+	m.UnitBid = util.PerUnit(auc.Bid, q)
+	m.UnitProfit = util.PerUnit(m.Profit, q)
+	prc.countSale(auc, m)
+	prc.countSellerResult(auc, m)
+	data_auc, err := json.Marshal(auc)
 	data_meta, err := json.Marshal(m)
 	if err != nil {
-		log.Panicf("marshall error: %s", err)
+		prc.Log.Panicf("marshall error: %s", err)
 	}
 	_, err = prc.FileAuc.WriteString(string(data_auc) + "\n")
 	_, err = prc.FileMeta.WriteString(string(data_meta) + "\n")
 	if err != nil {
-		log.Panicf("WriteString error: %s", err)
+		prc.Log.Panicf("WriteString error: %s", err)
 	}
 }
 
@@ -211,7 +321,21 @@ func (prc *AuctionProcessor) processAuction(auc *Auction) {
 func (prc *AuctionProcessor) Init(cf *config.Config, realm string) {
 	prc.cf = cf
 	prc.Realm = realm
-	prc.StateFName = cf.ResultDirectory + cf.GetName("state", prc.Realm) + ".gz"
+	prc.Log = log.New(log.Writer(), "["+realm+"] ", log.Flags()|log.Lmsgprefix)
+	json_fname := cf.ResultDirectory + cf.GetName("state", prc.Realm) + ".gz"
+	bin_fname := cf.ResultDirectory + cf.GetName("state", prc.Realm) + ".bin"
+	prc.JournalFName = cf.ResultDirectory + cf.GetName("journal", prc.Realm)
+	if cf.StateFormat == config.STATE_JSON {
+		prc.StateFName, prc.OldStateName = json_fname, bin_fname
+	} else {
+		prc.StateFName, prc.OldStateName = bin_fname, json_fname
+	}
+	prc.GapThreshold = DEFAULT_GAP_THRESHOLD
+	if d, err := time.ParseDuration(cf.GapThreshold); err == nil && d > 0 {
+		prc.GapThreshold = d
+	} else if cf.GapThreshold != "" {
+		prc.Log.Printf("bad gap_threshold value '%s', use %s", cf.GapThreshold, prc.GapThreshold)
+	}
 	prc.State.WorkSet = make(WorkSetType)
 	prc.State.WorkList = nil
 	prc.SnapshotTime = time.Time{}
@@ -226,49 +350,95 @@ func (prc *AuctionProcessor) Init(cf *config.Config, realm string) {
 	prc.NumAdjusts = 0
 }
 
+// из двух файлов состояния (в формате из конфига и в другом) взять
+// более свежий: так состояние переезжает при смене state_format
+func (prc *AuctionProcessor) pickStateFile() string {
+	cur, err_cur := os.Stat(prc.StateFName)
+	old, err_old := os.Stat(prc.OldStateName)
+	switch {
+	case err_old != nil:
+		return prc.StateFName
+	case err_cur != nil || old.ModTime().After(cur.ModTime()):
+		return prc.OldStateName
+	}
+	return prc.StateFName
+}
+
 func (prc *AuctionProcessor) LoadState() {
 	if prc.Started {
-		log.Panic("LoadState inside snapshot session")
+		prc.Log.Panic("LoadState inside snapshot session")
 	}
-	if util.CheckFile(prc.StateFName) {
-		log.Printf("AuctionProcessor loading state from %s ...", prc.StateFName)
-		data, _ := util.Load(prc.StateFName)
-		if err := json.Unmarshal(data, &prc.State); err != nil {
-			log.Panicf("... failed: %s", prc.StateFName, err)
+	// загрузка может быть и повторной (AbortSnapshot)
+	prc.State.LastTime = time.Time{}
+	prc.State.WorkSet = make(WorkSetType)
+	prc.State.WorkList = nil
+	fname := prc.pickStateFile()
+	if util.CheckFile(fname) {
+		prc.Log.Printf("AuctionProcessor loading state from %s ...", fname)
+		if fname != prc.StateFName {
+			prc.Log.Printf("... will be migrated to %s on save", prc.StateFName)
+		}
+		data, err := util.Load(fname)
+		if err == nil {
+			if strings.HasSuffix(fname, ".bin") {
+				err = decodeBinaryState(data, prc.Realm, &prc.State)
+			} else {
+				err = json.Unmarshal(data, &prc.State)
+			}
+		}
+		if err != nil {
+			prc.Log.Panicf("... %s failed: %s", fname, err)
 		}
-		log.Printf("... loaded with %d list enties", len(prc.State.WorkList))
+		prc.Log.Printf("... loaded with %d list enties", len(prc.State.WorkList))
 		prc.State.WorkSet = make(WorkSetType)
 		for _, e := range prc.State.WorkList {
+			if e.State.Latest.IsZero() { // состояние от версии с одним DeadLine
+				prc.narrowDeadLine(&e.State, prc.State.LastTime, e.Entry.TimeLeft)
+			}
 			prc.State.WorkSet[e.Entry.Auc] = e
 		}
+		prc.State.WorkList = nil
 	} else {
-		log.Printf("AuctionProcessor has no state named %s ...", prc.StateFName)
+		prc.Log.Printf("AuctionProcessor has no state named %s ...", prc.StateFName)
 	}
 }
 
 func (prc *AuctionProcessor) SaveState() {
 	if prc.Started {
-		log.Panic("SaveState inside snapshot session")
+		prc.Log.Panic("SaveState inside snapshot session")
 	}
-	log.Printf("AuctionProcessor storing state to %s ...", prc.StateFName)
-	log.Printf("... prepare list with %d enties", len(prc.State.WorkSet))
+	prc.Log.Printf("AuctionProcessor storing state to %s ...", prc.StateFName)
+	prc.Log.Printf("... prepare list with %d enties", len(prc.State.WorkSet))
+	prc.State.Realm = prc.Realm
 	prc.State.WorkList = WorkListType{}
 	for _, e := range prc.State.WorkSet {
 		prc.State.WorkList = append(prc.State.WorkList, e)
 	}
-	data, err := json.Marshal(&prc.State)
+	var data []byte
+	var err error
+	if strings.HasSuffix(prc.StateFName, ".bin") {
+		data, err = encodeBinaryState(&prc.State, prc.Realm)
+	} else {
+		data, err = json.Marshal(&prc.State)
+		if err == nil {
+			zdata := util.Zip(data)
+			prc.Log.Printf("... gzipped to %d%%", len(zdata)*100/len(data))
+			data = zdata
+		}
+	}
+	prc.State.WorkList = nil
 	if err != nil {
-		log.Fatalf("... failed: %s", err)
+		prc.Log.Fatalf("... failed: %s", err)
 	}
-	if strings.HasSuffix(prc.StateFName, ".gz") {
-		zdata := util.Zip(data)
-		log.Printf("store gzipped (%d%%) data to %s...",
-			len(zdata)*100/len(data), prc.StateFName)
-		util.Store(prc.StateFName, zdata)
-	} else {
-		log.Printf("store ungzipped data to %s...", prc.StateFName)
-		util.Store(prc.StateFName, data)
+	prc.Log.Printf("store %d bytes to %s...", len(data), prc.StateFName)
+	if err = util.Store(prc.StateFName, data); err != nil {
+		prc.Log.Fatalf("... failed: %s", err)
 	}
+	if util.CheckFile(prc.OldStateName) {
+		prc.Log.Printf("state migrated, remove %s", prc.OldStateName)
+		os.Remove(prc.OldStateName)
+	}
+	prc.resetJournal()
 }
 
 func (prc *AuctionProcessor) SnapshotNeeded(snaptime time.Time) bool {
@@ -277,7 +447,7 @@ func (prc *AuctionProcessor) SnapshotNeeded(snaptime time.Time) bool {
 
 func (prc *AuctionProcessor) StartSnapshot(snaptime time.Time) {
 	if prc.Started {
-		log.Panic("StartSnapshot inside snapshot session")
+		prc.Log.Panic("StartSnapshot inside snapshot session")
 	}
 	prc.Started = true
 	prc.SnapshotTime = snaptime
@@ -287,16 +457,34 @@ func (prc *AuctionProcessor) StartSnapshot(snaptime time.Time) {
 	prc.NumBids = 0
 	prc.NumMoves = 0
 	prc.NumAdjusts = 0
+	prc.NumConflicts = 0
 	prc.NumBought = 0
 	prc.NumAuctioned = 0
 	prc.NumExpired = 0
+	prc.NumUnknown = 0
+	prc.Gap = 0
+	if !prc.State.LastTime.IsZero() {
+		prc.Gap = snaptime.Sub(prc.State.LastTime)
+	}
+	if prc.GapDetected() {
+		prc.Log.Printf("%s: gap of %s since %s, closed auctions will be marked unknown",
+			util.TSStr(snaptime), prc.Gap, util.TSStr(prc.State.LastTime))
+	}
+	prc.sellers = make(map[string]*SellerActivity)
+	prc.lows = collectLows(prc.State.WorkSet)
+	prc.journalBegin()
 	// log.Printf("start snapshot at %s with %d entries in workset",
 	//	util.TSStr(prc.SnapshotTime), len(prc.State.WorkSet))
 }
 
+// были ли пропущены снимки перед текущим
+func (prc *AuctionProcessor) GapDetected() bool {
+	return prc.Gap > prc.GapThreshold
+}
+
 func (prc *AuctionProcessor) AddAuctionEntry(auc *Auction) {
 	if !prc.Started {
-		log.Panic("AddAuctionEntry outside snapshot session")
+		prc.Log.Panic("AddAuctionEntry outside snapshot session")
 	}
 	prc.processAuction(auc)
 }
@@ -312,26 +500,52 @@ func OpenOrCreateFile(fname string) *os.File {
 	return f
 }
 
+// файлы результатов, в которые пишет текущий снимок
+func (prc *AuctionProcessor) outputNames() []string {
+	var names []string
+	for _, name := range []string{"auctions", "metadata", "snapshot", "prices", "sales", "sellers"} {
+		names = append(names, prc.cf.ResultDirectory+prc.cf.GetTimedName(name, prc.Realm, prc.SnapshotTime))
+	}
+	return names
+}
+
+// при переигрывании журнала результаты уже на диске, пишем в никуда
+func (prc *AuctionProcessor) openOutput(fname string) *os.File {
+	if prc.Replaying {
+		fname = os.DevNull
+	}
+	return OpenOrCreateFile(fname)
+}
+
 func (prc *AuctionProcessor) FinishSnapshot() {
 	if !prc.Started {
-		log.Panic("FinishSnapshot outside snapshot session")
+		prc.Log.Panic("FinishSnapshot outside snapshot session")
 	}
 
 	// log.Println("check for closed auctions")
 	num_open, num_closed := 0, 0
-	auc_fname := prc.cf.ResultDirectory + prc.cf.GetTimedName("auctions", prc.Realm, prc.SnapshotTime)
-	meta_fname := prc.cf.ResultDirectory + prc.cf.GetTimedName("metadata", prc.Realm, prc.SnapshotTime)
-	snap_fname := prc.cf.ResultDirectory + prc.cf.GetTimedName("snapshot", prc.Realm, prc.SnapshotTime)
+	names := prc.outputNames()
 
-	prc.FileAuc = OpenOrCreateFile(auc_fname)
+	prc.FileAuc = prc.openOutput(names[0])
 	defer prc.FileAuc.Close()
 
-	prc.FileMeta = OpenOrCreateFile(meta_fname)
+	prc.FileMeta = prc.openOutput(names[1])
 	defer prc.FileMeta.Close()
 
-	SnapInfo := OpenOrCreateFile(snap_fname)
+	SnapInfo := prc.openOutput(names[2])
 	defer SnapInfo.Close()
 
+	PriceFile := prc.openOutput(names[3])
+	defer PriceFile.Close()
+
+	SalesFile := prc.openOutput(names[4])
+	defer SalesFile.Close()
+
+	SellersFile := prc.openOutput(names[5])
+	defer SellersFile.Close()
+
+	prc.sales = make(map[ItemKey]*ItemSales)
+
 	for id, _ := range prc.State.WorkSet {
 		_, seen := prc.SeenSet[id]
 		if !seen {
@@ -342,44 +556,73 @@ func (prc *AuctionProcessor) FinishSnapshot() {
 		}
 	}
 
+	// в WorkSet остались ровно лоты этого снимка
+	prices := CollectPrices(prc.SnapshotTime, prc.State.WorkSet)
+	if err := WritePrices(PriceFile, prices); err != nil {
+		prc.Log.Panicf("WritePrices error: %s", err)
+	}
+	if err := WriteSales(SalesFile, prc.sales); err != nil {
+		prc.Log.Panicf("WriteSales error: %s", err)
+	}
+	if err := WriteSellers(SellersFile, prc.sellers); err != nil {
+		prc.Log.Panicf("WriteSellers error: %s", err)
+	}
+	prc.lows = nil
+
+	num_known := num_closed - prc.NumUnknown
 	var rate int = 0
-	if num_closed > 0 {
-		rate = (prc.NumBought + prc.NumAuctioned) * 100 / num_closed
+	if num_known > 0 {
+		rate = (prc.NumBought + prc.NumAuctioned) * 100 / num_known
 	}
 
 	prc.TotalOpened += prc.NumCreated
-	prc.TotalClosed += num_closed
+	prc.TotalClosed += num_known
 	prc.TotalSuccess += prc.NumBought + prc.NumAuctioned
 	var total_rate int = 0
 	if prc.TotalClosed > 0 {
 		total_rate = prc.TotalSuccess * 100 / prc.TotalClosed
 	}
 
-	log.Printf("%s: \n"+
+	prc.Log.Printf("%s: \n"+
 		"    entries: %d\n"+
 		"    active: %d,\n"+
 		"    created: %d,\n"+
-		"    changed: %d [bids: %d, adj: %d, moves: %d]\n"+
-		"    closed: %d [bought: %d, auctioned: %d, expired: %d, succes: %d%%]",
+		"    changed: %d [bids: %d, adj: %d, moves: %d, conflicts: %d]\n"+
+		"    closed: %d [bought: %d, auctioned: %d, expired: %d, unknown: %d, succes: %d%%]",
 		util.TSStr(prc.SnapshotTime),
 		len(prc.State.WorkSet), num_open,
 		prc.NumCreated, prc.NumModified,
-		prc.NumBids, prc.NumAdjusts, prc.NumMoves,
-		num_closed, prc.NumBought, prc.NumAuctioned, prc.NumExpired, rate)
+		prc.NumBids, prc.NumAdjusts, prc.NumMoves, prc.NumConflicts,
+		num_closed, prc.NumBought, prc.NumAuctioned, prc.NumExpired, prc.NumUnknown, rate)
 
-	log.Printf("total created %d, closed %d, success %d%%",
-		prc.TotalOpened, prc.TotalClosed, total_rate)
+	prc.Log.Printf("total created %d, closed %d, success %d%%, %d items priced",
+		prc.TotalOpened, prc.TotalClosed, total_rate, len(prices))
 
+	gap := ""
+	if prc.GapDetected() {
+		gap = fmt.Sprintf(" GAP since %s", util.TSStr(prc.State.LastTime))
+	}
 	SnapInfo.WriteString(
 		fmt.Sprintf("%s: entries:%d  active:%d created:%d "+
 			"changed:%d [bids:%d adj:%d moves:%d] "+
-			"closed:%d [bought:%d auctioned:%d expired:%d rate:%d%%]\n",
+			"closed:%d [bought:%d auctioned:%d expired:%d unknown:%d rate:%d%%] "+
+			"interval:%s%s\n",
 			util.TSStr(prc.SnapshotTime),
 			len(prc.State.WorkSet), num_open,
 			prc.NumCreated, prc.NumModified,
 			prc.NumBids, prc.NumAdjusts, prc.NumMoves,
-			num_closed, prc.NumBought, prc.NumAuctioned, prc.NumExpired,
-			rate))
+			num_closed, prc.NumBought, prc.NumAuctioned, prc.NumExpired, prc.NumUnknown,
+			rate, prc.Gap, gap))
+
+	if prc.journal != nil && !prc.Replaying {
+		// сначала данные на диск, потом отметка в журнале
+		for _, f := range []*os.File{prc.FileAuc, prc.FileMeta, SnapInfo, PriceFile, SalesFile, SellersFile} {
+			if err := f.Sync(); err != nil {
+				prc.Log.Panicf("sync %s failed: %s", f.Name(), err)
+			}
+		}
+		prc.journalCommit()
+	}
 
 	prc.State.LastTime = prc.SnapshotTime
 	//log.Printf("last time sets to %s", util.TSStr(prc.State.LastTime))
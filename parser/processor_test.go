@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEarlyProbability(t *testing.T) {
+	at := func(h float64) time.Time {
+		return testStart.Add(time.Duration(h * float64(time.Hour)))
+	}
+	cases := []struct {
+		name                               string
+		gone_min, gone_max, dl_min, dl_max float64 // часы от testStart
+		want                               float64
+	}{
+		{"gone before deadline", 0, 1, 2, 12, 1},
+		{"gone after deadline", 13, 14, 2, 12, 0},
+		{"same intervals", 2, 12, 2, 12, 0.5},
+		{"half before", 0, 4, 2, 12, 0.5 + 0.5*0.9},
+		{"exact deadline", 0, 2, 1, 1, 0.5}, // width == 0
+		{"exact deadline before", 0, 1, 2, 2, 1},
+		{"exact deadline after", 3, 4, 2, 2, 0},
+		{"seen at once", 4.5, 4.5, 2, 12, 0.75}, // span == 0
+	}
+	for _, c := range cases {
+		got := early_probability(at(c.gone_min), at(c.gone_max), at(c.dl_min), at(c.dl_max))
+		if math.Abs(got-c.want) > 0.01 {
+			t.Errorf("%s: early probability %.3f, want %.3f", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNarrowDeadLine(t *testing.T) {
+	prc := new(AuctionProcessor)
+	var st AuctionState
+	check := func(step string, earliest, latest time.Duration, conflicts int) {
+		if !st.Earliest.Equal(testStart.Add(earliest)) || !st.Latest.Equal(testStart.Add(latest)) ||
+			!st.DeadLine.Equal(st.Latest) || prc.NumConflicts != conflicts {
+			t.Errorf("%s: [%s, %s] deadline %s, %d conflicts; want [%s, %s], %d conflicts",
+				step, st.Earliest.Sub(testStart), st.Latest.Sub(testStart),
+				st.DeadLine.Sub(testStart), prc.NumConflicts, earliest, latest, conflicts)
+		}
+	}
+
+	prc.narrowDeadLine(&st, testStart, S_LONG)
+	check("first observation", 2*time.Hour, 12*time.Hour, 0)
+
+	prc.narrowDeadLine(&st, testStart.Add(time.Hour), S_MEDIUM) // 1h30m .. 3h
+	check("narrowed", 2*time.Hour, 3*time.Hour, 0)
+	if !st.Updated.Equal(testStart.Add(time.Hour)) {
+		t.Errorf("updated %s, want %s", st.Updated, testStart.Add(time.Hour))
+	}
+
+	prc.narrowDeadLine(&st, testStart.Add(4*time.Hour), S_SHORT) // 4h .. 4h30m
+	check("conflict", 4*time.Hour, 4*time.Hour+30*time.Minute, 1)
+}
+
+// лот без выкупа, исчезнувший задолго до самого раннего срока, истечь не
+// мог: его отозвали. метка expired, но уверенность в ней низкая
+func TestCloseConfidence(t *testing.T) {
+	cf := testConfig(t)
+	lot := func(id, buyout int64, timeLeft string) string {
+		return fmt.Sprintf(`{"auc":%d,"item":1,"owner":"A","ownerRealm":"Test",`+
+			`"bid":100,"buyout":%d,"quantity":1,"timeLeft":"%s"}`, id, buyout, timeLeft)
+	}
+	writeDump(t, cf, 0, `{"auctions":[`+
+		lot(1, 0, S_VERY_LONG)+","+ // отозван: до срока не меньше 12h
+		lot(2, 0, S_SHORT)+","+ // истёк
+		lot(3, 500, S_VERY_LONG)+","+ // выкуплен
+		lot(4, 0, S_VERY_LONG)+`]}`)
+	writeDump(t, cf, 1, `{"auctions":[`+lot(4, 0, S_VERY_LONG)+`]}`)
+	ParseDir(cf, testRealm, false)
+
+	got := make(map[int64]AuctionMeta)
+	for _, line := range readResults(t, cf)["metadata"] {
+		var m AuctionMeta
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		got[m.Auc] = m
+	}
+	cases := []struct {
+		auc     int64
+		result  string
+		conf_lo float64
+		conf_hi float64
+	}{
+		{1, "expired", 0, 0.01},
+		{2, "expired", 0.95, 1},
+		{3, "bought", BUYOUT_SHARE - 0.01, BUYOUT_SHARE},
+	}
+	for _, c := range cases {
+		m, ok := got[c.auc]
+		if !ok {
+			t.Errorf("auction %d not closed", c.auc)
+			continue
+		}
+		if m.Result != c.result || m.Confidence < c.conf_lo || m.Confidence > c.conf_hi {
+			t.Errorf("auction %d: %s with confidence %.3f, want %s in [%.2f, %.2f]",
+				c.auc, m.Result, m.Confidence, c.result, c.conf_lo, c.conf_hi)
+		}
+	}
+	if len(got) != len(cases) {
+		t.Errorf("%d auctions closed, want %d", len(got), len(cases))
+	}
+}
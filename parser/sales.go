@@ -0,0 +1,148 @@
+package parser
+
+// продажи по предметам: только закрытые лоты. на каждый снимок пишется
+// строка по каждому предмету, у которого что-то закрылось; по дням
+// строки сводит DailySales. "unknown" (пропуск снимков) не считается ни
+// продажей, ни истечением
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type ItemSales struct {
+	Time time.Time `json:"time"`
+	ItemKey
+	Sold         int   `json:"sold"` // лотов bought + auctioned
+	SoldUnits    int64 `json:"soldUnits"`
+	Revenue      int64 `json:"revenue"`   // медь, сумма Profit
+	UnitPrice    int64 `json:"unitPrice"` // = AvgPrice() на момент записи
+	Expired      int   `json:"expired"`
+	ExpiredUnits int64 `json:"expiredUnits"`
+}
+
+// средняя цена продажи за штуку
+func (s *ItemSales) AvgPrice() int64 {
+	return util.PerUnit(s.Revenue, s.SoldUnits)
+}
+
+// доля проданных лотов среди закрывшихся с известным исходом
+func (s *ItemSales) SellThrough() float64 {
+	if s.Sold+s.Expired == 0 {
+		return 0
+	}
+	return float64(s.Sold) / float64(s.Sold+s.Expired)
+}
+
+func (s *ItemSales) add(other *ItemSales) {
+	s.Sold += other.Sold
+	s.SoldUnits += other.SoldUnits
+	s.Revenue += other.Revenue
+	s.Expired += other.Expired
+	s.ExpiredUnits += other.ExpiredUnits
+}
+
+// учесть закрытый лот в продажах снимка
+func (prc *AuctionProcessor) countSale(auc *Auction, m *AuctionMeta) {
+	key := itemKey(auc)
+	s := prc.sales[key]
+	if s == nil {
+		s = &ItemSales{Time: prc.SnapshotTime, ItemKey: key}
+		prc.sales[key] = s
+	}
+	switch m.Result {
+	case "bought", "auctioned":
+		s.Sold++
+		s.SoldUnits += int64(auc.Quantity)
+		s.Revenue += m.Profit
+	case "expired":
+		s.Expired++
+		s.ExpiredUnits += int64(auc.Quantity)
+	}
+}
+
+func WriteSales(w io.Writer, sales map[ItemKey]*ItemSales) error {
+	var list []*ItemSales
+	for _, s := range sales {
+		if s.Sold+s.Expired > 0 {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Item != list[j].Item {
+			return list[i].Item < list[j].Item
+		}
+		return list[i].Pet < list[j].Pet
+	})
+	for _, s := range list {
+		s.UnitPrice = s.AvgPrice()
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// продажи по дням (Time - начало дня, UTC) за [from, to]
+// для всех предметов или одного, если only != nil
+func DailySales(cf *config.Config, realm string, from, to time.Time,
+	only *ItemKey) (map[ItemKey][]*ItemSales, error) {
+	days := make(map[ItemKey]map[time.Time]*ItemSales)
+	err := readMonthly(cf, "sales", realm, from, to, func(line []byte) error {
+		var s ItemSales
+		if err := json.Unmarshal(line, &s); err != nil {
+			return err
+		}
+		if s.Time.Before(from) || s.Time.After(to) || (only != nil && s.ItemKey != *only) {
+			return nil
+		}
+		day := s.Time.Truncate(24 * time.Hour)
+		if days[s.ItemKey] == nil {
+			days[s.ItemKey] = make(map[time.Time]*ItemSales)
+		}
+		d := days[s.ItemKey][day]
+		if d == nil {
+			d = &ItemSales{Time: day, ItemKey: s.ItemKey}
+			days[s.ItemKey][day] = d
+		}
+		d.add(&s)
+		d.UnitPrice = d.AvgPrice()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[ItemKey][]*ItemSales)
+	for key, m := range days {
+		var list []*ItemSales
+		for _, d := range m {
+			list = append(list, d)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+		result[key] = list
+	}
+	return result, nil
+}
+
+// свести дни в итог за весь период
+func TotalSales(days []*ItemSales) *ItemSales {
+	total := new(ItemSales)
+	for _, d := range days {
+		if total.Time.IsZero() {
+			total.Time = d.Time
+			total.ItemKey = d.ItemKey
+		}
+		total.add(d)
+	}
+	total.UnitPrice = total.AvgPrice()
+	return total
+}
@@ -0,0 +1,264 @@
+package parser
+
+// продавцы: кто что выставляет, насколько сбивает цену, как часто продаёт
+// и в какие часы активен. на каждый снимок пишется строка по каждому
+// продавцу, у которого что-то появилось или закрылось; за период строки
+// сводит SellerProfiles. без владельцев в API (новый формат) пусто
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type ItemCount struct {
+	ItemKey
+	Count int `json:"count"`
+}
+
+type SellerActivity struct {
+	Time      time.Time   `json:"time"`
+	Seller    string      `json:"seller"` // имя-реалм
+	Posted    int         `json:"posted"` // новых лотов
+	Items     []ItemCount `json:"items,omitempty"`
+	Compared  int         `json:"compared"`  // новых лотов, которые было с чем сравнить
+	Undercuts int         `json:"undercuts"` // из них дешевле чужого минимума
+	Depth     int64       `json:"depth"`     // сумма подрезок, сотые доли процента
+	Sold      int         `json:"sold"`
+	Expired   int         `json:"expired"`
+	Revenue   int64       `json:"revenue"` // медь
+	items     map[ItemKey]int
+}
+
+type SellerProfile struct {
+	SellerActivity
+	Hours [24]int `json:"hours"` // новых лотов по часам снимка, UTC
+}
+
+// доля проданных среди закрывшихся с известным исходом
+func (s *SellerActivity) SuccessRate() float64 {
+	if s.Sold+s.Expired == 0 {
+		return 0
+	}
+	return float64(s.Sold) / float64(s.Sold+s.Expired)
+}
+
+// доля новых лотов, выставленных дешевле чужого минимума
+func (s *SellerActivity) UndercutRate() float64 {
+	if s.Compared == 0 {
+		return 0
+	}
+	return float64(s.Undercuts) / float64(s.Compared)
+}
+
+// средняя подрезка в процентах от чужого минимума
+func (s *SellerActivity) AvgUndercut() float64 {
+	if s.Undercuts == 0 {
+		return 0
+	}
+	return float64(s.Depth) / float64(s.Undercuts) / 100
+}
+
+// самые частые предметы, не больше n
+func (s *SellerActivity) TopItems(n int) []ItemCount {
+	list := append([]ItemCount(nil), s.Items...)
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Item < list[j].Item
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (s *SellerActivity) add(other *SellerActivity) {
+	s.Posted += other.Posted
+	s.Compared += other.Compared
+	s.Undercuts += other.Undercuts
+	s.Depth += other.Depth
+	s.Sold += other.Sold
+	s.Expired += other.Expired
+	s.Revenue += other.Revenue
+	if s.items == nil {
+		s.items = make(map[ItemKey]int)
+	}
+	for _, ic := range other.Items {
+		s.items[ic.ItemKey] += ic.Count
+	}
+}
+
+// перенести счётчики предметов из map в отсортированный Items
+func (s *SellerActivity) flushItems() {
+	s.Items = s.Items[:0]
+	for key, n := range s.items {
+		s.Items = append(s.Items, ItemCount{key, n})
+	}
+	sort.Slice(s.Items, func(i, j int) bool {
+		if s.Items[i].Item != s.Items[j].Item {
+			return s.Items[i].Item < s.Items[j].Item
+		}
+		return s.Items[i].Pet < s.Items[j].Pet
+	})
+}
+
+func sellerName(auc *Auction) string {
+	if auc.Owner == "" {
+		return ""
+	}
+	return auc.Owner + "-" + auc.OwnerRealm
+}
+
+type priceMark struct {
+	unit   int64
+	seller string
+}
+
+// два самых дешёвых лота предмета от разных продавцов
+type itemLow [2]priceMark
+
+// минимум, с которым сравнивается новый лот продавца: свой не в счёт
+func (l *itemLow) against(seller string) int64 {
+	if l[0].seller != seller {
+		return l[0].unit
+	}
+	return l[1].unit
+}
+
+func (l *itemLow) put(m priceMark) {
+	switch {
+	case l[0].unit == 0 || m.unit < l[0].unit:
+		if l[0].seller != m.seller {
+			l[1] = l[0]
+		}
+		l[0] = m
+	case m.seller != l[0].seller && (l[1].unit == 0 || m.unit < l[1].unit):
+		l[1] = m
+	}
+}
+
+// минимальные цены за штуку по лотам прошлого снимка
+func collectLows(ws WorkSetType) map[ItemKey]*itemLow {
+	lows := make(map[ItemKey]*itemLow)
+	for _, e := range ws {
+		auc := &e.Entry
+		if auc.Buyout <= 0 || auc.Quantity <= 0 {
+			continue
+		}
+		key := itemKey(auc)
+		l := lows[key]
+		if l == nil {
+			l = new(itemLow)
+			lows[key] = l
+		}
+		l.put(priceMark{util.PerUnit(auc.Buyout, int64(auc.Quantity)), sellerName(auc)})
+	}
+	return lows
+}
+
+func (prc *AuctionProcessor) sellerActivity(seller string) *SellerActivity {
+	s := prc.sellers[seller]
+	if s == nil {
+		s = &SellerActivity{Time: prc.SnapshotTime, Seller: seller, items: make(map[ItemKey]int)}
+		prc.sellers[seller] = s
+	}
+	return s
+}
+
+// учесть новый лот
+func (prc *AuctionProcessor) countPost(auc *Auction) {
+	seller := sellerName(auc)
+	if seller == "" || prc.State.LastTime.IsZero() {
+		// в первом снимке все лоты новые, когда выставлены - неизвестно
+		return
+	}
+	s := prc.sellerActivity(seller)
+	key := itemKey(auc)
+	s.Posted++
+	s.items[key]++
+	if auc.Buyout <= 0 || auc.Quantity <= 0 || prc.lows[key] == nil {
+		return
+	}
+	ref := prc.lows[key].against(seller)
+	if ref == 0 {
+		return
+	}
+	s.Compared++
+	if unit := util.PerUnit(auc.Buyout, int64(auc.Quantity)); unit < ref {
+		s.Undercuts++
+		s.Depth += (ref - unit) * 10000 / ref
+	}
+}
+
+// учесть закрытый лот
+func (prc *AuctionProcessor) countSellerResult(auc *Auction, m *AuctionMeta) {
+	seller := sellerName(auc)
+	if seller == "" {
+		return
+	}
+	s := prc.sellerActivity(seller)
+	switch m.Result {
+	case "bought", "auctioned":
+		s.Sold++
+		s.Revenue += m.Profit
+	case "expired":
+		s.Expired++
+	}
+}
+
+func WriteSellers(w io.Writer, sellers map[string]*SellerActivity) error {
+	var list []*SellerActivity
+	for _, s := range sellers {
+		if s.Posted+s.Sold+s.Expired > 0 {
+			s.flushItems()
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Seller < list[j].Seller })
+	for _, s := range list {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// профили продавцов за [from, to]: всех или одного, если only != ""
+func SellerProfiles(cf *config.Config, realm string, from, to time.Time,
+	only string) (map[string]*SellerProfile, error) {
+	profiles := make(map[string]*SellerProfile)
+	err := readMonthly(cf, "sellers", realm, from, to, func(line []byte) error {
+		var s SellerActivity
+		if err := json.Unmarshal(line, &s); err != nil {
+			return err
+		}
+		if s.Time.Before(from) || s.Time.After(to) || (only != "" && s.Seller != only) {
+			return nil
+		}
+		p := profiles[s.Seller]
+		if p == nil {
+			p = &SellerProfile{SellerActivity: SellerActivity{Time: s.Time, Seller: s.Seller}}
+			profiles[s.Seller] = p
+		}
+		p.add(&s)
+		p.Hours[s.Time.Hour()] += s.Posted
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		p.flushItems()
+	}
+	return profiles, nil
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// лот продавца seller с выкупом unit за штуку
+func sellerLot(id, item int64, seller string, unit int64, quantity int) string {
+	return fmt.Sprintf(`{"auc":%d,"item":%d,"owner":"%s","ownerRealm":"Test",`+
+		`"bid":1,"buyout":%d,"quantity":%d,"timeLeft":"VERY_LONG"}`,
+		id, item, seller, unit*int64(quantity), quantity)
+}
+
+func TestSellerUndercuts(t *testing.T) {
+	old := []string{
+		sellerLot(1, 500, "A", 100, 1), // A - минимум
+		sellerLot(2, 500, "B", 120, 1), // B - чужой минимум для A
+		sellerLot(3, 500, "C", 150, 1),
+		sellerLot(4, 600, "A", 50, 1),  // A - единственный продавец
+		sellerLot(5, 800, "E", 100, 1), // два самых дешёвых - оба E
+		sellerLot(6, 800, "E", 90, 1),
+		sellerLot(7, 800, "F", 200, 1),
+	}
+	posted := []string{
+		sellerLot(10, 500, "A", 110, 1), // свой минимум не в счёт: 120 -> 110
+		sellerLot(11, 500, "B", 100, 2), // вровень с минимумом A
+		sellerLot(12, 500, "C", 80, 1),  // 100 -> 80
+		sellerLot(13, 600, "A", 40, 1),  // сравнивать не с чем
+		sellerLot(14, 700, "D", 10, 1),  // предмета не было
+		sellerLot(15, 500, "D", 0, 1),   // без выкупа
+		sellerLot(16, 800, "E", 95, 1),  // 200 -> 95
+		sellerLot(17, 800, "F", 95, 1),  // дороже 90 у E
+	}
+	cf := testConfig(t)
+	writeDump(t, cf, 0, `{"auctions":[`+strings.Join(old, ",")+`]}`)
+	writeDump(t, cf, 1, `{"auctions":[`+strings.Join(append(old, posted...), ",")+`]}`)
+	ParseDir(cf, testRealm, false)
+
+	got := make(map[string]SellerActivity)
+	for _, line := range readResults(t, cf)["sellers"] {
+		var s SellerActivity
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Time.Equal(snapTime(1)) {
+			t.Errorf("%s: activity at %s, want only at %s", s.Seller, s.Time, snapTime(1))
+		}
+		got[strings.TrimSuffix(s.Seller, "-Test")] = s
+	}
+	cases := []struct {
+		seller                      string
+		posted, compared, undercuts int
+		depth                       int64
+	}{
+		{"A", 2, 1, 1, (120 - 110) * 10000 / 120},
+		{"B", 1, 1, 0, 0},
+		{"C", 1, 1, 1, (100 - 80) * 10000 / 100},
+		{"D", 2, 0, 0, 0},
+		{"E", 1, 1, 1, (200 - 95) * 10000 / 200},
+		{"F", 1, 1, 0, 0},
+	}
+	for _, c := range cases {
+		s := got[c.seller]
+		if s.Posted != c.posted || s.Compared != c.compared ||
+			s.Undercuts != c.undercuts || s.Depth != c.depth {
+			t.Errorf("%s: posted %d compared %d undercuts %d depth %d; "+
+				"want %d, %d, %d, %d", c.seller, s.Posted, s.Compared, s.Undercuts, s.Depth,
+				c.posted, c.compared, c.undercuts, c.depth)
+		}
+	}
+	if len(got) != len(cases) {
+		t.Errorf("%d sellers, want %d", len(got), len(cases))
+	}
+}
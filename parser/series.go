@@ -0,0 +1,43 @@
+package parser
+
+// помесячные ряды результатов (prices, sales, ...): JSON-строки
+// в файлах GetTimedName(name, realm, месяц)
+
+import (
+	"bufio"
+	"os"
+	"time"
+
+	config "github.com/gourytch/gowowuction/config"
+)
+
+// пройти строки помесячных файлов name, захватывающих [from, to]
+func readMonthly(cf *config.Config, name string, realm string, from, to time.Time,
+	fn func(line []byte) error) error {
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(to) {
+		fname := cf.ResultDirectory + cf.GetTimedName(name, realm, month)
+		month = month.AddDate(0, 1, 0)
+		f, err := os.Open(fname)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if err = fn(scanner.Bytes()); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = scanner.Err()
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package parser
+
+// двоичный формат состояния AuctionProcessor:
+//   "GWAUCST\n"           - сигнатура
+//   uvarint               - версия формата
+//   uvarint + байты       - реалм
+//   gzip(gob(stateBody))  - само состояние
+// заголовок не сжат, его можно прочитать, не распаковывая остального
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	STATE_MAGIC   = "GWAUCST\n"
+	STATE_VERSION = 1
+)
+
+type stateBody struct {
+	LastTime time.Time
+	Entries  WorkListType
+}
+
+func encodeBinaryState(state *AuctionProcessorState, realm string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(STATE_MAGIC)
+	var num [binary.MaxVarintLen64]byte
+	buf.Write(num[:binary.PutUvarint(num[:], STATE_VERSION)])
+	buf.Write(num[:binary.PutUvarint(num[:], uint64(len(realm)))])
+	buf.WriteString(realm)
+	z, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	body := stateBody{LastTime: state.LastTime, Entries: state.WorkList}
+	if err := gob.NewEncoder(z).Encode(&body); err != nil {
+		return nil, err
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBinaryState(data []byte, realm string, state *AuctionProcessorState) error {
+	r := bufio.NewReader(bytes.NewReader(data))
+	magic := make([]byte, len(STATE_MAGIC))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != STATE_MAGIC {
+		return fmt.Errorf("not a binary state file")
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if version != STATE_VERSION {
+		return fmt.Errorf("unsupported state format version %d", version)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > 1024 {
+		return fmt.Errorf("bad realm in header")
+	}
+	name := make([]byte, n)
+	if _, err = io.ReadFull(r, name); err != nil {
+		return err
+	}
+	if string(name) != realm {
+		return fmt.Errorf("state belongs to realm %s, not %s", name, realm)
+	}
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	var body stateBody
+	if err = gob.NewDecoder(z).Decode(&body); err != nil {
+		return err
+	}
+	state.Realm = realm
+	state.LastTime = body.LastTime
+	state.WorkList = body.Entries
+	return nil
+}
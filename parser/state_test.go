@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	config "github.com/gourytch/gowowuction/config"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+func testState() *AuctionProcessorState {
+	st := &AuctionProcessorState{Realm: testRealm, LastTime: snapTime(5)}
+	for i := int64(1); i <= 3; i++ {
+		var e WorkEntry
+		e.Entry.Auc = i
+		e.Entry.Item = 1000 + i
+		e.Entry.Owner = "Seller"
+		e.Entry.Buyout = 200 * i
+		e.Entry.Quantity = int32(i)
+		e.Entry.TimeLeft = S_LONG
+		e.Entry.BonusLists = []Bonus{{int32(i)}}
+		e.State.Created = snapTime(int(i))
+		e.State.Earliest = snapTime(int(i) + 2)
+		e.State.Latest = snapTime(int(i) + 12)
+		e.State.DeadLine = e.State.Latest
+		e.State.Raised = i == 2
+		e.State.LastBid = 100 * i
+		st.WorkList = append(st.WorkList, e)
+	}
+	return st
+}
+
+// сравнение через JSON: так не мешают внутренности time.Time
+func sameJSON(t *testing.T, a, b interface{}) bool {
+	da, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(da, db)
+}
+
+func TestBinaryStateRoundTrip(t *testing.T) {
+	st := testState()
+	data, err := encodeBinaryState(st, testRealm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AuctionProcessorState
+	if err = decodeBinaryState(data, testRealm, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.LastTime.Equal(st.LastTime) || !sameJSON(t, got.WorkList, st.WorkList) {
+		t.Errorf("round trip mismatch:\n got  %+v\n want %+v", got, st)
+	}
+
+	if err = decodeBinaryState(data, "eu:other", &got); err == nil {
+		t.Error("state of another realm accepted")
+	}
+	if err = decodeBinaryState([]byte("{}"), testRealm, &got); err == nil {
+		t.Error("json accepted as binary state")
+	}
+	bad := append([]byte(nil), data...)
+	bad[len(STATE_MAGIC)] = STATE_VERSION + 1
+	if err = decodeBinaryState(bad, testRealm, &got); err == nil {
+		t.Error("unknown version accepted")
+	}
+}
+
+// смена state_format: состояние подхватывается из старого файла,
+// сохраняется в новом, старый удаляется; содержимое не меняется
+func TestStateMigration(t *testing.T) {
+	cf := testConfig(t)
+	writeDump(t, cf, 0, legacyDump(1, 2, 3))
+	writeDump(t, cf, 1, legacyDump(2, 3, 4))
+	ParseDir(cf, testRealm, false)
+
+	load := func(format string) *AuctionProcessor {
+		cf.StateFormat = format
+		prc := new(AuctionProcessor)
+		prc.Init(cf, testRealm)
+		prc.LoadState()
+		return prc
+	}
+	orig := load(config.STATE_JSON)
+	if len(orig.State.WorkSet) != 3 {
+		t.Fatalf("%d entries in json state, want 3", len(orig.State.WorkSet))
+	}
+	for _, to := range []string{config.STATE_BINARY, config.STATE_JSON} {
+		prc := load(to)
+		prc.SaveState()
+		if util.CheckFile(prc.OldStateName) {
+			t.Errorf("%s: old state %s not removed", to, prc.OldStateName)
+		}
+		again := load(to)
+		if !again.State.LastTime.Equal(orig.State.LastTime) ||
+			!sameJSON(t, again.State.WorkSet, orig.State.WorkSet) {
+			t.Errorf("%s: state changed after migration", to)
+		}
+	}
+}
+
+func TestDefaultStateFormat(t *testing.T) {
+	// существующие установки не должны менять формат при обновлении
+	if f := config.Default(t.TempDir()).StateFormat; f != config.STATE_JSON {
+		t.Errorf("default state format %s, want %s", f, config.STATE_JSON)
+	}
+}
@@ -0,0 +1,197 @@
+package parser
+
+// потоковый разбор дампа: лоты читаются по одному прямо из gzip,
+// так что память не растёт с размером реалма.
+// понимает и старый (api.battle.net), и новый (api.blizzard.com) формат:
+// формат определяется по первому лоту ("auc" или "id")
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type AuctionStream struct {
+	Realms []Realm // заполняется, если "realms" идёт в дампе до "auctions"
+	Count  int     // сколько лотов уже выдано
+
+	closers []io.Closer
+	dec     *json.Decoder
+	started bool // открывающая скобка объекта прочитана
+	inside  bool // внутри массива "auctions"
+	done    bool
+	format  string // "?" до первого лота, потом "legacy" или "modern"
+	err     error
+}
+
+// открыть дамп fname (.json или .json.gz)
+func OpenAuctionStream(fname string) (*AuctionStream, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	closers := []io.Closer{f}
+	if strings.HasSuffix(fname, ".gz") {
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("gzip: %s", err)
+		}
+		r = z
+		closers = append(closers, z)
+	}
+	s := NewAuctionStream(r)
+	s.closers = closers
+	return s, nil
+}
+
+// разбирать уже распакованный JSON из r
+func NewAuctionStream(r io.Reader) *AuctionStream {
+	return &AuctionStream{dec: json.NewDecoder(r)}
+}
+
+func (s *AuctionStream) Close() error {
+	var err error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if e := s.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.closers = nil
+	return err
+}
+
+// ошибка, на которой остановился Next (nil, если дамп дочитан до конца)
+func (s *AuctionStream) Err() error {
+	return s.err
+}
+
+func (s *AuctionStream) fail(err error) bool {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if strings.HasPrefix(err.Error(), "json: ") {
+		s.err = err // UnmarshalTypeError и прочие уже с префиксом
+	} else {
+		s.err = fmt.Errorf("json: %s", err)
+	}
+	s.done = true
+	return false
+}
+
+func (s *AuctionStream) expect(delim json.Delim) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("'%s' expected, got %v", delim, tok)
+	}
+	return nil
+}
+
+// дойти до начала массива "auctions", попутно прочитав "realms".
+// false - ключей больше нет (объект закрыт)
+func (s *AuctionStream) seekAuctions() (bool, error) {
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return false, err
+		}
+		switch tok {
+		case "auctions":
+			if err := s.expect('['); err != nil {
+				return false, err
+			}
+			return true, nil
+		case "realms":
+			if err := s.dec.Decode(&s.Realms); err != nil {
+				return false, err
+			}
+		default: // _links, connected_realm, ...
+			var skip json.RawMessage
+			if err := s.dec.Decode(&skip); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, s.expect('}')
+}
+
+func detectFormat(raw json.RawMessage) (string, error) {
+	var probe struct {
+		Auc *int64 `json:"auc"`
+		Id  *int64 `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return "", err
+	}
+	switch {
+	case probe.Auc != nil:
+		return "legacy", nil
+	case probe.Id != nil:
+		return "modern", nil
+	}
+	return "", fmt.Errorf("unknown auction format: %.100s", raw)
+}
+
+// прочитать следующий лот в auc. false - лоты кончились или случилась
+// ошибка (см. Err). после false дамп проверен до закрывающей скобки
+func (s *AuctionStream) Next(auc *Auction) bool {
+	if s.done {
+		return false
+	}
+	if !s.inside {
+		if !s.started {
+			if err := s.expect('{'); err != nil {
+				return s.fail(err)
+			}
+			s.started = true
+		}
+		found, err := s.seekAuctions()
+		if err != nil {
+			return s.fail(err)
+		}
+		if !found {
+			s.done = true
+			return false
+		}
+		s.inside = true
+		s.format = "?"
+	}
+	if !s.dec.More() {
+		// массив кончился: дочитать остальные ключи и закрыть объект
+		if err := s.expect(']'); err != nil {
+			return s.fail(err)
+		}
+		s.inside = false
+		return s.Next(auc)
+	}
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err != nil {
+		return s.fail(err)
+	}
+	if s.format == "?" {
+		format, err := detectFormat(raw)
+		if err != nil {
+			return s.fail(err)
+		}
+		s.format = format
+	}
+	*auc = Auction{}
+	if s.format == "modern" {
+		var m ModernAuction
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return s.fail(err)
+		}
+		*auc = ConvertModernAuction(&m)
+	} else if err := json.Unmarshal(raw, auc); err != nil {
+		return s.fail(err)
+	}
+	s.Count++
+	return true
+}
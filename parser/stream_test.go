@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func readAll(data string) ([]Auction, error) {
+	s := NewAuctionStream(strings.NewReader(data))
+	var list []Auction
+	var auc Auction
+	for s.Next(&auc) {
+		list = append(list, auc)
+	}
+	return list, s.Err()
+}
+
+func TestStreamLegacy(t *testing.T) {
+	list, err := readAll(`{"realms":[{"name":"Fordragon","slug":"fordragon"}],
+		"auctions":[
+			{"auc":1,"item":10,"owner":"A","ownerRealm":"R","bid":5,"buyout":10,"quantity":2,"timeLeft":"LONG"},
+			{"auc":2,"item":11,"owner":"B","ownerRealm":"R","bid":7,"buyout":0,"quantity":1,"timeLeft":"SHORT"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Auc != 1 || list[1].Owner != "B" || list[0].Quantity != 2 {
+		t.Errorf("unexpected auctions: %+v", list)
+	}
+}
+
+func TestStreamModern(t *testing.T) {
+	list, err := readAll(`{"_links":{"self":{"href":"x"}},
+		"auctions":[
+			{"id":1,"item":{"id":10},"buyout":30,"quantity":3,"time_left":"LONG"},
+			{"id":2,"item":{"id":11},"unit_price":4,"quantity":5,"time_left":"SHORT"}],
+		"connected_realm":{"href":"y"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Item != 10 || list[1].Buyout != 20 || list[1].TimeLeft != "SHORT" {
+		t.Errorf("unexpected auctions: %+v", list)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	cases := []string{
+		`{"auctions":[{"auc":1,"quantity":"x"}]}`,
+		`{"auctions":[{"auc":1}`,
+		`{"auctions":[{"foo":1}]}`,
+		`[]`,
+	}
+	for _, data := range cases {
+		_, err := readAll(data)
+		if err == nil {
+			t.Errorf("%s: error expected", data)
+			continue
+		}
+		if msg := err.Error(); !strings.HasPrefix(msg, "json: ") || strings.HasPrefix(msg, "json: json: ") {
+			t.Errorf("%s: bad error message %q", data, msg)
+		}
+	}
+}
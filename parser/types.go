@@ -115,3 +115,26 @@ type SnapshotData struct {
 	Realms   []Realm   `json:"realms"`
 	Auctions []Auction `json:"auctions"`
 }
+
+// формат /data/wow/connected-realm/{id}/auctions (api.blizzard.com)
+
+type ModernItem struct {
+	Id           int64   `json:"id"`
+	Context      int64   `json:"context"`
+	BonusLists   []int32 `json:"bonus_lists"`
+	Modifiers    ModList `json:"modifiers"`
+	PetBreedId   int     `json:"pet_breed_id"`
+	PetLevel     int     `json:"pet_level"`
+	PetQualityId int     `json:"pet_quality_id"`
+	PetSpeciesId int     `json:"pet_species_id"`
+}
+
+type ModernAuction struct {
+	Id        int64      `json:"id"`
+	Item      ModernItem `json:"item"`
+	Bid       int64      `json:"bid"`
+	Buyout    int64      `json:"buyout"`
+	UnitPrice int64      `json:"unit_price"`
+	Quantity  int32      `json:"quantity"`
+	TimeLeft  string     `json:"time_left"`
+}
@@ -0,0 +1,76 @@
+package main
+
+// общее для команд-отчётов (marketvalue, sales, seller):
+// флаги --realm, --at, --days, проверка обязательных флагов,
+// период отчёта и вывод CSV. команда разбирает свои флаги и
+// возвращает оставшиеся аргументы
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+type reportFlags struct {
+	*flag.FlagSet
+	Realm *string
+	At    *string
+	Days  *int
+}
+
+func newReportFlags(name string, days int, atUsage, daysUsage string) *reportFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return &reportFlags{
+		FlagSet: fs,
+		Realm:   fs.String("realm", "", "realm, region:slug"),
+		At:      fs.String("at", "", atUsage+" YYYYMMDD_HHMMSS (UTC), default now"),
+		Days:    fs.Int("days", days, daysUsage),
+	}
+}
+
+// без --realm или при !ok - подсказка и выход
+func (rf *reportFlags) Require(ok bool, what string) {
+	if *rf.Realm != "" && ok {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: --realm and %s are required\n", rf.Name(), what)
+	rf.Usage()
+	os.Exit(2)
+}
+
+// конец периода: --at или текущее время
+func (rf *reportFlags) End() time.Time {
+	if *rf.At == "" {
+		return time.Now().UTC()
+	}
+	ts, err := util.ParseTS(*rf.At)
+	if err != nil {
+		log.Fatalf("bad --at '%s': %s", *rf.At, err)
+	}
+	return ts
+}
+
+func (rf *reportFlags) Window() time.Duration {
+	return time.Duration(*rf.Days) * 24 * time.Hour
+}
+
+// записать CSV в файл fname ('-' - stdout)
+func (rf *reportFlags) Export(fname string, write func(w io.Writer) error) {
+	var w io.Writer = os.Stdout
+	if fname != "-" {
+		f, err := os.Create(fname)
+		if err != nil {
+			log.Fatalf("%s: %s", rf.Name(), err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w); err != nil {
+		log.Fatalf("%s: export failed: %s", rf.Name(), err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+
+	config "github.com/gourytch/gowowuction/config"
+	parser "github.com/gourytch/gowowuction/parser"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+// gowowuction sales --realm R --item ID [--pet N] [--at TS] [--days N]
+// gowowuction sales --realm R --export FILE|-
+func DoSales(cf *config.Config, args []string) []string {
+	fs := newReportFlags("sales", cf.ReportDays, "period end", "period length, days")
+	realm, days := fs.Realm, fs.Days
+	item := fs.Int64("item", 0, "item id")
+	pet := fs.Int("pet", 0, "pet species id (for caged pets)")
+	export := fs.String("export", "", "write per-item totals as CSV to file ('-' for stdout)")
+	fs.Parse(args)
+	fs.Require((*item == 0) != (*export == ""), "either --item or --export")
+	to := fs.End()
+	from := to.Add(-fs.Window())
+
+	var only *parser.ItemKey
+	if *item != 0 {
+		only = &parser.ItemKey{Item: *item, Pet: *pet}
+	}
+	sales, err := parser.DailySales(cf, *realm, from, to, only)
+	if err != nil {
+		log.Fatalf("sales: %s", err)
+	}
+	if only != nil {
+		list := sales[*only]
+		if len(list) == 0 {
+			fmt.Printf("%s item %d: no closed auctions in %d days before %s\n",
+				*realm, *item, *days, util.TSStr(to))
+			return fs.Args()
+		}
+		fmt.Printf("%-10s %6s %8s %16s %7s %6s\n", "day", "sold", "units", "avg/unit", "expired", "sell%")
+		for _, d := range list {
+			fmt.Printf("%-10s %6d %8d %16s %7d %5.1f%%\n", d.Time.Format("2006-01-02"),
+				d.Sold, d.SoldUnits, util.FormatMoney(d.AvgPrice()), d.Expired, d.SellThrough()*100)
+		}
+		t := parser.TotalSales(list)
+		fmt.Printf("%-10s %6d %8d %16s %7d %5.1f%%\n", "total",
+			t.Sold, t.SoldUnits, util.FormatMoney(t.AvgPrice()), t.Expired, t.SellThrough()*100)
+		return fs.Args()
+	}
+
+	fs.Export(*export, func(w io.Writer) error {
+		return exportSales(w, sales)
+	})
+	log.Printf("sales: %d items exported", len(sales))
+	return fs.Args()
+}
+
+func exportSales(w io.Writer, sales map[parser.ItemKey][]*parser.ItemSales) error {
+	var totals []*parser.ItemSales
+	for _, days := range sales {
+		totals = append(totals, parser.TotalSales(days))
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Item != totals[j].Item {
+			return totals[i].Item < totals[j].Item
+		}
+		return totals[i].Pet < totals[j].Pet
+	})
+	c := csv.NewWriter(w)
+	c.Write([]string{"item", "pet", "sold", "sold_units", "avg_price", "expired", "expired_units", "sell_through"})
+	for _, t := range totals {
+		c.Write([]string{
+			strconv.FormatInt(t.Item, 10),
+			strconv.Itoa(t.Pet),
+			strconv.Itoa(t.Sold),
+			strconv.FormatInt(t.SoldUnits, 10),
+			strconv.FormatInt(t.AvgPrice(), 10),
+			strconv.Itoa(t.Expired),
+			strconv.FormatInt(t.ExpiredUnits, 10),
+			strconv.FormatFloat(t.SellThrough(), 'f', 3, 64),
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
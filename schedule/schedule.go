@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// расписание в духе cron: "минуты часы дни_месяца месяцы дни_недели".
+// в каждом поле допустимы *, числа, диапазоны a-b, шаг /n и списки через запятую
+type Schedule struct {
+	Expr   string
+	minute [60]bool
+	hour   [24]bool
+	dom    [32]bool
+	month  [13]bool
+	dow    [7]bool
+	anyDom bool
+	anyDow bool
+}
+
+func parseField(field string, min, max int, set []bool) (any bool, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return false, fmt.Errorf("bad step in '%s'", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+			any = any || step == 1
+		case strings.Contains(part, "-"):
+			v := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(v[0]); err != nil {
+				return false, fmt.Errorf("bad range '%s'", part)
+			}
+			if hi, err = strconv.Atoi(v[1]); err != nil {
+				return false, fmt.Errorf("bad range '%s'", part)
+			}
+		default:
+			if lo, err = strconv.Atoi(part); err != nil {
+				return false, fmt.Errorf("bad value '%s'", part)
+			}
+			hi = lo
+			if step > 1 { // "5/15" == "5-max/15"
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return false, fmt.Errorf("'%s' out of range %d-%d", part, min, max)
+		}
+		for x := lo; x <= hi; x += step {
+			set[x] = true
+		}
+	}
+	return any, nil
+}
+
+func Parse(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule '%s': 5 fields expected", expr)
+	}
+	s := &Schedule{Expr: expr}
+	var err error
+	if _, err = parseField(fields[0], 0, 59, s.minute[:]); err == nil {
+		if _, err = parseField(fields[1], 0, 23, s.hour[:]); err == nil {
+			if s.anyDom, err = parseField(fields[2], 1, 31, s.dom[:]); err == nil {
+				if _, err = parseField(fields[3], 1, 12, s.month[:]); err == nil {
+					var dow [8]bool // 7 тоже воскресенье
+					if s.anyDow, err = parseField(fields[4], 0, 7, dow[:]); err == nil {
+						copy(s.dow[:], dow[:7])
+						s.dow[0] = s.dow[0] || dow[7]
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("schedule '%s': %s", expr, err)
+	}
+	return s, nil
+}
+
+// подходит ли день: как в cron, если заданы оба поля дней - достаточно любого
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[t.Weekday()]
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dow
+	case s.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// ближайший момент срабатывания строго после t (с точностью до минуты)
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0) // заведомо невыполнимое расписание вроде 30 февраля
+	for t.Before(limit) {
+		if !s.month[t.Month()] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): error expected", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	cases := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2026-10-18 10:00", "2026-10-18 10:01"},
+		{"*/10 * * * *", "2026-10-18 10:00", "2026-10-18 10:10"},
+		{"*/10 * * * *", "2026-10-18 10:55", "2026-10-18 11:00"},
+		{"5 * * * *", "2026-10-18 10:05", "2026-10-18 11:05"},
+		{"5/20 * * * *", "2026-10-18 10:26", "2026-10-18 10:45"},
+		{"30 3 * * *", "2026-10-18 10:00", "2026-10-19 03:30"},
+		{"0 9-17/4 * * *", "2026-10-18 13:00", "2026-10-18 17:00"},
+		{"0 0 1 * *", "2026-10-18 10:00", "2026-11-01 00:00"},
+		{"0 0 1 1 *", "2026-10-18 10:00", "2027-01-01 00:00"},
+		{"0 0 * * 1", "2026-10-18 10:00", "2026-10-19 00:00"}, // воскресенье -> понедельник
+		{"0 0 * * 7", "2026-10-18 10:00", "2026-10-25 00:00"}, // 7 == 0, воскресенье
+		{"0 0 * * 0,6", "2026-10-19 10:00", "2026-10-24 00:00"},
+		// заданы оба поля дней: достаточно любого
+		{"0 0 20 * 1", "2026-10-18 10:00", "2026-10-19 00:00"},
+		{"0 0 29 2 *", "2026-10-18 10:00", "2028-02-29 00:00"},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", c.expr, err)
+			continue
+		}
+		if got := s.Next(at(c.from)); !got.Equal(at(c.want)) {
+			t.Errorf("%q.Next(%s) = %s, want %s", c.expr, c.from, got, c.want)
+		}
+	}
+}
+
+func TestNextSubMinute(t *testing.T) {
+	s, _ := Parse("* * * * *")
+	from := at("2026-10-18 10:00").Add(30 * time.Second)
+	if got, want := s.Next(from), at("2026-10-18 10:01"); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s, want %s", from, got, want)
+	}
+}
+
+func TestNextImpossible(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(at("2026-10-18 10:00")); !got.IsZero() {
+		t.Errorf("30 Feb: got %s, want zero time", got)
+	}
+}
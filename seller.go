@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	config "github.com/gourytch/gowowuction/config"
+	parser "github.com/gourytch/gowowuction/parser"
+	util "github.com/gourytch/gowowuction/util"
+)
+
+// gowowuction seller --realm R --name NAME-REALM [--at TS] [--days N]
+// gowowuction seller --realm R --top N [--by revenue|sold|posted] [--at TS] [--days N]
+func DoSeller(cf *config.Config, args []string) []string {
+	fs := newReportFlags("seller", cf.ReportDays, "period end", "period length, days")
+	realm, days := fs.Realm, fs.Days
+	name := fs.String("name", "", "seller, Name-Realm")
+	top := fs.Int("top", 0, "show N top sellers of the realm")
+	by := fs.String("by", "revenue", "top sellers order: revenue, sold or posted")
+	fs.Parse(args)
+	fs.Require((*name == "") != (*top == 0), "either --name or --top")
+	to := fs.End()
+	from := to.Add(-fs.Window())
+
+	profiles, err := parser.SellerProfiles(cf, *realm, from, to, *name)
+	if err != nil {
+		log.Fatalf("seller: %s", err)
+	}
+	if *name != "" {
+		p := profiles[*name]
+		if p == nil {
+			fmt.Printf("%s seller %s: no activity in %d days before %s\n",
+				*realm, *name, *days, util.TSStr(to))
+			return fs.Args()
+		}
+		printSellerProfile(p)
+		return fs.Args()
+	}
+
+	var list []*parser.SellerProfile
+	for _, p := range profiles {
+		list = append(list, p)
+	}
+	var key func(p *parser.SellerProfile) int64
+	switch *by {
+	case "revenue":
+		key = func(p *parser.SellerProfile) int64 { return p.Revenue }
+	case "sold":
+		key = func(p *parser.SellerProfile) int64 { return int64(p.Sold) }
+	case "posted":
+		key = func(p *parser.SellerProfile) int64 { return int64(p.Posted) }
+	default:
+		log.Fatalf("bad --by '%s'", *by)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if key(list[i]) != key(list[j]) {
+			return key(list[i]) > key(list[j])
+		}
+		return list[i].Seller < list[j].Seller
+	})
+	if len(list) > *top {
+		list = list[:*top]
+	}
+	fmt.Printf("%-24s %7s %6s %7s %6s %6s %18s\n",
+		"seller", "posted", "sold", "expired", "succ%", "under%", "revenue")
+	for _, p := range list {
+		fmt.Printf("%-24s %7d %6d %7d %5.1f%% %5.1f%% %18s\n",
+			p.Seller, p.Posted, p.Sold, p.Expired, p.SuccessRate()*100,
+			p.UndercutRate()*100, util.FormatMoney(p.Revenue))
+	}
+	return fs.Args()
+}
+
+func printSellerProfile(p *parser.SellerProfile) {
+	fmt.Printf("seller %s\n", p.Seller)
+	fmt.Printf("  posted:   %d lots of %d items\n", p.Posted, len(p.Items))
+	fmt.Printf("  closed:   sold %d, expired %d, success %.1f%%\n",
+		p.Sold, p.Expired, p.SuccessRate()*100)
+	fmt.Printf("  revenue:  %s\n", util.FormatMoney(p.Revenue))
+	fmt.Printf("  undercut: %d of %d compared (%.1f%%), by %.2f%% on average\n",
+		p.Undercuts, p.Compared, p.UndercutRate()*100, p.AvgUndercut())
+	var items []string
+	for _, ic := range p.TopItems(5) {
+		if ic.Pet != 0 {
+			items = append(items, fmt.Sprintf("%d/pet %d x%d", ic.Item, ic.Pet, ic.Count))
+		} else {
+			items = append(items, fmt.Sprintf("%d x%d", ic.Item, ic.Count))
+		}
+	}
+	fmt.Printf("  items:    %s\n", strings.Join(items, ", "))
+	max := 0
+	for _, n := range p.Hours {
+		if n > max {
+			max = n
+		}
+	}
+	fmt.Println("  posted by hour (UTC):")
+	for h, n := range p.Hours {
+		bar := 0
+		if max > 0 {
+			bar = n * 40 / max
+		}
+		fmt.Printf("    %02d %5d %s\n", h, n, strings.Repeat("#", bar))
+	}
+}
@@ -0,0 +1,312 @@
+package simulator
+
+// модель аукциона для проверки эвристик AuctionProcessor:
+// продавцы выставляют лоты, покупатели делают ставки и выкупают,
+// лоты истекают или снимаются. на каждый момент снимка пишется дамп
+// в формате api.battle.net, а в конце - "правда" о том, чем кончился каждый лот
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	util "github.com/gourytch/gowowuction/util"
+)
+
+const (
+	R_BOUGHT    = "bought"
+	R_AUCTIONED = "auctioned"
+	R_EXPIRED   = "expired"
+	R_CANCELLED = "cancelled"
+	R_OPEN      = "open" // к концу моделирования ещё не закрыт
+)
+
+type Params struct {
+	Realm       string
+	Start       time.Time
+	Duration    time.Duration // сколько моделировать
+	Interval    time.Duration // шаг между снимками
+	Jitter      time.Duration // случайный сдвиг момента снимка
+	Sellers     int
+	Items       int
+	PostRate    float64 // новых лотов в час
+	BuyoutRate  float64 // интенсивность выкупа лота, раз в час
+	BidRate     float64 // интенсивность ставок на лот, раз в час
+	CancelRate  float64 // интенсивность снятия лота продавцом, раз в час
+	NoBuyoutPct float64 // доля лотов без цены выкупа
+	Seed        int64
+}
+
+func DefaultParams() Params {
+	return Params{
+		Realm:       "eu:simulated",
+		Start:       time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Duration:    72 * time.Hour,
+		Interval:    time.Hour,
+		Jitter:      10 * time.Minute,
+		Sellers:     50,
+		Items:       40,
+		PostRate:    60,
+		BuyoutRate:  0.03,
+		BidRate:     0.02,
+		CancelRate:  0.005,
+		NoBuyoutPct: 0.1,
+		Seed:        1,
+	}
+}
+
+// как на самом деле закончился лот
+type Truth struct {
+	Auc      int64     `json:"auc"`
+	Item     int64     `json:"item"`
+	Owner    string    `json:"owner"`
+	Quantity int32     `json:"quantity"`
+	Created  time.Time `json:"created"`
+	DeadLine time.Time `json:"deadline"`
+	Ended    time.Time `json:"ended"`
+	Result   string    `json:"result"`
+	Price    int64     `json:"price"` // сколько заплачено за весь лот (0, если не продан)
+}
+
+type simAuction struct {
+	Truth
+	startBid int64
+	buyout   int64
+	bids     []time.Time // моменты ставок до окончания
+}
+
+type Simulator struct {
+	P        Params
+	rnd      *rand.Rand
+	sellers  []string
+	basis    []int64   // базовая цена единицы товара
+	special  [][]int64 // товары, которыми торгует продавец
+	auctions []*simAuction
+	nextId   int64
+}
+
+func New(p Params) *Simulator {
+	sim := &Simulator{P: p, rnd: rand.New(rand.NewSource(p.Seed)), nextId: 1000000}
+	for i := 0; i < p.Items; i++ {
+		// цены от 1 серебра до ~1000 золота, лог-равномерно
+		sim.basis = append(sim.basis, int64(math.Exp(sim.rnd.Float64()*math.Log(1e5)))*100)
+	}
+	names := []string{"Ar", "Bel", "Cor", "Dra", "El", "Fen", "Gor", "Hal", "Ir", "Jor"}
+	for i := 0; i < p.Sellers; i++ {
+		sim.sellers = append(sim.sellers,
+			names[i%len(names)]+strings.Repeat("a", 1+i/len(names))+"th")
+		var items []int64
+		for j := 0; j < 1+sim.rnd.Intn(4); j++ {
+			items = append(items, int64(sim.rnd.Intn(p.Items)))
+		}
+		sim.special = append(sim.special, items)
+	}
+	return sim
+}
+
+// момент первого события пуассоновского потока с интенсивностью rate в час
+func (sim *Simulator) after(t time.Time, rate float64) time.Time {
+	if rate <= 0 {
+		return t.Add(1000 * time.Hour)
+	}
+	return t.Add(time.Duration(sim.rnd.ExpFloat64() / rate * float64(time.Hour)))
+}
+
+func (sim *Simulator) post(t time.Time) {
+	seller := sim.rnd.Intn(len(sim.sellers))
+	items := sim.special[seller]
+	idx := items[sim.rnd.Intn(len(items))]
+	a := new(simAuction)
+	sim.nextId++
+	a.Auc = sim.nextId
+	a.Item = 2000 + idx
+	a.Owner = sim.sellers[seller]
+	a.Quantity = int32([]int{1, 1, 1, 5, 10, 20, 200}[sim.rnd.Intn(7)])
+	unit := float64(sim.basis[idx]) * math.Exp(sim.rnd.NormFloat64()*0.2)
+	a.buyout = int64(unit) * int64(a.Quantity)
+	a.startBid = a.buyout * int64(70+sim.rnd.Intn(25)) / 100
+	if a.startBid < 1 {
+		a.startBid = 1
+	}
+	if sim.rnd.Float64() < sim.P.NoBuyoutPct {
+		a.buyout = 0
+	}
+	a.Created = t
+	a.DeadLine = t.Add([]time.Duration{12 * time.Hour, 24 * time.Hour, 48 * time.Hour}[sim.rnd.Intn(3)])
+
+	// кто раньше: выкуп или срок. снять лот можно только до первой ставки
+	a.Ended, a.Result = a.DeadLine, R_EXPIRED
+	if a.buyout > 0 {
+		if bt := sim.after(t, sim.P.BuyoutRate); bt.Before(a.Ended) {
+			a.Ended, a.Result = bt, R_BOUGHT
+		}
+	}
+	for bt := sim.after(t, sim.P.BidRate); bt.Before(a.Ended); bt = sim.after(bt, sim.P.BidRate) {
+		a.bids = append(a.bids, bt)
+	}
+	if ct := sim.after(t, sim.P.CancelRate); ct.Before(a.Ended) &&
+		(len(a.bids) == 0 || ct.Before(a.bids[0])) {
+		a.Ended, a.Result = ct, R_CANCELLED
+	}
+	switch a.Result {
+	case R_BOUGHT:
+		a.Price = a.buyout
+	case R_EXPIRED:
+		if len(a.bids) > 0 {
+			a.Result = R_AUCTIONED
+			a.Price = a.bidAt(a.Ended)
+		}
+	}
+	sim.auctions = append(sim.auctions, a)
+}
+
+// текущая ставка: каждая чужая ставка поднимает цену на 5%
+func (a *simAuction) bidAt(t time.Time) int64 {
+	bid := a.startBid
+	for _, bt := range a.bids {
+		if bt.After(t) {
+			break
+		}
+		bid += bid/20 + 1
+		if a.buyout > 0 && bid >= a.buyout {
+			bid = a.buyout - 1
+		}
+	}
+	return bid
+}
+
+func timeLeft(d time.Duration) string {
+	switch {
+	case d < 30*time.Minute:
+		return "SHORT"
+	case d < 2*time.Hour:
+		return "MEDIUM"
+	case d < 12*time.Hour:
+		return "LONG"
+	}
+	return "VERY_LONG"
+}
+
+type dumpRealm struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type dumpAuction struct {
+	Auc        int64  `json:"auc"`
+	Item       int64  `json:"item"`
+	Owner      string `json:"owner"`
+	OwnerRealm string `json:"ownerRealm"`
+	Bid        int64  `json:"bid"`
+	Buyout     int64  `json:"buyout"`
+	Quantity   int32  `json:"quantity"`
+	TimeLeft   string `json:"timeLeft"`
+	Rand       int64  `json:"rand"`
+	Seed       int64  `json:"seed"`
+	Context    int64  `json:"context"`
+}
+
+type dump struct {
+	Realms   []dumpRealm   `json:"realms"`
+	Auctions []dumpAuction `json:"auctions"`
+}
+
+func (sim *Simulator) snapshot(t time.Time) *dump {
+	slug := strings.SplitN(sim.P.Realm, ":", 2)[1]
+	name := strings.ToUpper(slug[:1]) + slug[1:]
+	d := &dump{Realms: []dumpRealm{{name, slug}}}
+	for _, a := range sim.auctions {
+		if a.Created.After(t) || !a.Ended.After(t) {
+			continue
+		}
+		d.Auctions = append(d.Auctions, dumpAuction{
+			Auc:        a.Auc,
+			Item:       a.Item,
+			Owner:      a.Owner,
+			OwnerRealm: name,
+			Bid:        a.bidAt(t),
+			Buyout:     a.buyout,
+			Quantity:   a.Quantity,
+			TimeLeft:   timeLeft(a.DeadLine.Sub(t)),
+		})
+	}
+	return d
+}
+
+// прогнать модель, записать снимки в outdir и вернуть имя файла с правдой
+func (sim *Simulator) Run(outdir string) (truth_fname string, err error) {
+	p := sim.P
+	end := p.Start.Add(p.Duration)
+	// лоты начинают выставляться за двое суток до первого снимка,
+	// чтобы в нём уже были лоты всех возрастов
+	t0 := p.Start.Add(-48 * time.Hour)
+	for t := sim.after(t0, p.PostRate); t.Before(end); t = sim.after(t, p.PostRate) {
+		sim.post(t)
+	}
+	log.Printf("simulated %d auctions", len(sim.auctions))
+	num := 0
+	for t := p.Start; t.Before(end); t = t.Add(p.Interval) {
+		ts := t
+		if p.Jitter > 0 {
+			ts = t.Add(time.Duration(sim.rnd.Int63n(int64(p.Jitter))))
+		}
+		ts = ts.Truncate(time.Second)
+		data, err := json.Marshal(sim.snapshot(ts))
+		if err != nil {
+			return "", err
+		}
+		fname := outdir + util.Make_FName(p.Realm, ts, true)
+		if err = util.Store(fname, util.Zip(data)); err != nil {
+			return "", err
+		}
+		num++
+	}
+	log.Printf("%d snapshots written to %s", num, outdir)
+
+	truth_fname = outdir + util.Safe_Realm(p.Realm) + "-truth.json"
+	f, err := os.Create(truth_fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	sort.Slice(sim.auctions, func(i, j int) bool { return sim.auctions[i].Auc < sim.auctions[j].Auc })
+	for _, a := range sim.auctions {
+		if a.Ended.Before(p.Start) {
+			continue // не попал ни в один снимок
+		}
+		tr := a.Truth
+		if !tr.Ended.Before(end) {
+			tr.Result, tr.Price, tr.Ended = R_OPEN, 0, time.Time{}
+		}
+		data, _ := json.Marshal(&tr)
+		w.Write(data)
+		w.WriteString("\n")
+	}
+	return truth_fname, w.Flush()
+}
+
+// прочитать файл с правдой: auc -> Truth
+func LoadTruth(fname string) (map[int64]Truth, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	truth := make(map[int64]Truth)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var t Truth
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			return nil, err
+		}
+		truth[t.Auc] = t
+	}
+	return truth, scanner.Err()
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// в пакете syscall для windows нет LockFileEx, берём из kernel32
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	LOCKFILE_FAIL_IMMEDIATELY = 0x1
+	LOCKFILE_EXCLUSIVE_LOCK   = 0x2
+)
+
+// блокировки в windows обязательные: запирается байт далеко за концом
+// файла, чтобы pid в начале оставался читаемым для других
+func lockRange() *syscall.Overlapped {
+	return &syscall.Overlapped{OffsetHigh: 0x40000000}
+}
+
+func lockFile(f *os.File) error {
+	r, _, err := procLockFileEx.Call(f.Fd(),
+		LOCKFILE_EXCLUSIVE_LOCK|LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0,
+		uintptr(unsafe.Pointer(lockRange())))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) {
+	procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(lockRange())))
+}
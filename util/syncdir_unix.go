@@ -0,0 +1,15 @@
+//go:build !windows
+
+package util
+
+import "os"
+
+// сбросить на диск каталог, чтобы переименование в нём пережило сбой
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package util
+
+// в windows каталог не открыть для FlushFileBuffers, а переименование
+// в NTFS и так журналируется
+func SyncDir(dir string) error {
+	return nil
+}
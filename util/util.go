@@ -3,14 +3,17 @@ package util
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,10 +33,26 @@ func TSStr(ts time.Time) string {
 	return ts.Format("20060102_150405")
 }
 
+// обратное к TSStr (время в UTC)
+func ParseTS(s string) (time.Time, error) {
+	return time.Parse("20060102_150405", s)
+}
+
 func Safe_Realm(realm string) string {
 	return strings.Replace(realm, ":", "-", -1)
 }
 
+// псевдо-реалм для общерегионального аукциона товаров (commodities)
+const COMMODITIES = "commodities"
+
+func CommoditiesRealm(region string) string {
+	return region + ":" + COMMODITIES
+}
+
+func IsCommoditiesRealm(realm string) bool {
+	return strings.HasSuffix(realm, ":"+COMMODITIES)
+}
+
 func Make_FName(realm string, ts time.Time, zipped bool) string {
 	n := fmt.Sprintf("%s-%s.json", Safe_Realm(realm), TSStr(ts.UTC()))
 	if zipped {
@@ -42,13 +61,20 @@ func Make_FName(realm string, ts time.Time, zipped bool) string {
 	return n
 }
 
+// имя файла с метаданными снимка (рядом с самим снимком)
+func Make_MetaFName(realm string, ts time.Time) string {
+	return fmt.Sprintf("%s-%s.meta.json", Safe_Realm(realm), TSStr(ts.UTC()))
+}
+
+var rxFName = regexp.MustCompile("^([^-]+)-([^-]+)-(\\d{8}_\\d{6})\\.json\\.gz$")
+
+// разобрать имя снимка реалма. снимки commodities сюда не попадают
 func Parse_FName(fname string) (realm string, ts time.Time, good bool) {
 	good = false
 	// log.Printf("Parse_FName(%s)", fname)
 	name := filepath.Base(fname)
-	rx := regexp.MustCompile("^([^-]+)-([^-]+)-(\\d{8}_\\d{6})\\.json\\.gz$")
-	v := rx.FindStringSubmatch(name)
-	if v == nil {
+	v := rxFName.FindStringSubmatch(name)
+	if v == nil || v[2] == COMMODITIES {
 		//log.Panicf("... not matched")
 		return
 	}
@@ -63,6 +89,35 @@ func Parse_FName(fname string) (realm string, ts time.Time, good bool) {
 	return
 }
 
+// eu-commodities-20261018_120000.json.gz
+func Make_CommoditiesFName(region string, ts time.Time, zipped bool) string {
+	return Make_FName(CommoditiesRealm(region), ts, zipped)
+}
+
+func Parse_CommoditiesFName(fname string) (region string, ts time.Time, good bool) {
+	v := rxFName.FindStringSubmatch(filepath.Base(fname))
+	if v == nil || v[2] != COMMODITIES {
+		return "", ts, false
+	}
+	ts, err := time.Parse("20060102_150405", v[3])
+	if err != nil {
+		return "", ts, false
+	}
+	return v[1], ts, true
+}
+
+// разобрать имя снимка любого вида. для commodities realm="region:commodities"
+func Parse_AnyFName(fname string) (realm string, ts time.Time, good bool) {
+	if realm, ts, good = Parse_FName(fname); good {
+		return
+	}
+	region, ts, good := Parse_CommoditiesFName(fname)
+	if !good {
+		return "", ts, false
+	}
+	return CommoditiesRealm(region), ts, true
+}
+
 // получить полный путь до исполняемого файла
 func ExeName() string {
 	exe, err := filepath.Abs(os.Args[0])
@@ -117,7 +172,7 @@ func CheckJSON(data []byte) {
 	if err := json.Unmarshal(data, &r); err != nil {
 		log.Fatal("broken")
 	}
-	log.Print("=== postmortem ===  %f", data)
+	log.Printf("=== postmortem ===  %s", data)
 }
 
 // сжать данные gzip-ом
@@ -159,8 +214,210 @@ func LoadData(zdata []byte) []byte {
 	return ubody
 }
 
+// записать данные атомарно: во временный файл рядом, fsync, проверка
+// (см. VerifyFile), и только потом переименование в fname.
+// недописанный файл под окончательным именем так не появится
 func Store(fname string, data []byte) error {
-	return ioutil.WriteFile(fname, data, 0644)
+	f, err := ioutil.TempFile(filepath.Dir(fname), ".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpname := f.Name()
+	if err = f.Chmod(0644); err == nil { // TempFile создаёт 0600
+		if _, err = f.Write(data); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = CommitTemp(tmpname, fname)
+	}
+	if err != nil {
+		os.Remove(tmpname)
+	}
+	return err
+}
+
+// проверить содержимое файла по его окончательному имени name:
+// для .gz - gzip читается до конца (CRC и длина в трейлере сходятся),
+// для .json / .json.gz - внутри синтаксически верный JSON
+func VerifyFile(path string, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("gzip: %s", err)
+		}
+		defer z.Close()
+		r = z
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	if strings.HasSuffix(name, ".json") {
+		dec := json.NewDecoder(r)
+		depth := 0
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("json: %s", err)
+			}
+			switch tok {
+			case json.Delim('{'), json.Delim('['):
+				depth++
+			case json.Delim('}'), json.Delim(']'):
+				depth--
+			}
+		}
+		if depth != 0 {
+			return fmt.Errorf("json: unexpected end of data")
+		}
+	}
+	// дочитать остаток, чтобы gzip проверил трейлер
+	if _, err = io.Copy(ioutil.Discard, r); err != nil {
+		return fmt.Errorf("gzip: %s", err)
+	}
+	return nil
+}
+
+// быстрая проверка .gz без распаковки: заголовок gzip и трейлер с
+// ненулевым размером содержимого. так ловятся пустые, обрезанные до
+// заголовка и вовсе не gzip файлы; битое содержимое ловит уже разбор
+func CheckGzip(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < 18 { // 10 байт заголовка + 8 трейлера
+		return fmt.Errorf("gzip: file too short (%d bytes)", fi.Size())
+	}
+	var head [10]byte
+	if _, err = io.ReadFull(f, head[:]); err != nil {
+		return fmt.Errorf("gzip: %s", err)
+	}
+	if head[0] != 0x1f || head[1] != 0x8b || head[2] != 8 {
+		return fmt.Errorf("gzip: invalid header")
+	}
+	var tail [8]byte
+	if _, err = f.ReadAt(tail[:], fi.Size()-8); err != nil {
+		return fmt.Errorf("gzip: %s", err)
+	}
+	if binary.LittleEndian.Uint32(tail[4:]) == 0 {
+		return fmt.Errorf("gzip: empty content")
+	}
+	return nil
+}
+
+// есть ли готовый снимок fname. битый снимок переименовывается в
+// fname.broken (чтобы его можно было разглядеть) и считается отсутствующим
+func CheckSnapshot(fname string) bool {
+	if !CheckFile(fname) {
+		return false
+	}
+	if err := VerifyFile(fname, fname); err != nil {
+		log.Printf("%s is broken (%s), moved away to re-download", fname, err)
+		if err = os.Rename(fname, fname+".broken"); err != nil {
+			log.Printf("... rename failed: %s", err)
+		}
+		return false
+	}
+	return true
+}
+
+// сколько входных октетов между отчётами о ходе записи потока
+const STREAM_REPORT_STEP = 32 << 20
+
+type writeCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *writeCounter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
+
+// записать поток r, сжимая gzip-ом, во временный файл в каталоге dir.
+// report (если не nil) вызывается по ходу записи с числом октетов на входе
+// и на выходе. при ошибке временный файл удаляется
+func StoreStreamTemp(dir string, r io.Reader, report func(in, out int64)) (tmpname string, out int64, err error) {
+	f, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpname = f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpname)
+		}
+	}()
+	if err = f.Chmod(0644); err != nil { // TempFile создаёт 0600
+		return "", 0, err
+	}
+	fout := &writeCounter{w: f}
+	gz := gzip.NewWriter(fout)
+	buf := make([]byte, 1<<16)
+	var in, reported int64
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if _, err = gz.Write(buf[:n]); err != nil {
+				return "", 0, err
+			}
+			in += int64(n)
+			if report != nil && in-reported >= STREAM_REPORT_STEP {
+				report(in, fout.n)
+				reported = in
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			return "", 0, err
+		}
+	}
+	if in == 0 {
+		err = fmt.Errorf("empty stream")
+		return "", 0, err
+	}
+	if err = gz.Close(); err != nil {
+		return "", 0, err
+	}
+	if err = f.Sync(); err != nil {
+		return "", 0, err
+	}
+	if err = f.Close(); err != nil {
+		return "", 0, err
+	}
+	return tmpname, fout.n, nil
+}
+
+// проверить временный файл (см. VerifyFile) и переименовать в окончательный
+func CommitTemp(tmpname string, fname string) error {
+	if err := VerifyFile(tmpname, fname); err != nil {
+		return fmt.Errorf("%s verification failed: %s", fname, err)
+	}
+	if err := os.Rename(tmpname, fname); err != nil {
+		return err
+	}
+	return SyncDir(filepath.Dir(fname))
 }
 
 func Load(fname string) (data []byte, err error) {
@@ -186,3 +443,89 @@ func Load(fname string) (data []byte, err error) {
 	}
 	return ioutil.ReadFile(fname)
 }
+
+// метаданные снимка: какие реалмы обслуживает скачанный аукцион.
+// сам снимок лежит под именем первого из них
+type SnapshotMeta struct {
+	Region         string    `json:"region"`
+	ConnectedRealm int64     `json:"connectedRealm"`
+	Realms         []string  `json:"realms"`
+	Time           time.Time `json:"time"`
+}
+
+func StoreMeta(fname string, meta *SnapshotMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return Store(fname, data)
+}
+
+// файл-блокировка, чтобы не запустить два экземпляра над одними данными.
+// блокировка снимается ядром и при аварийном завершении процесса
+// (lockFile/unlockFile - в lock_unix.go и lock_windows.go)
+type LockFile struct {
+	f *os.File
+}
+
+func Lock(path string) (*LockFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		data, _ := ioutil.ReadAll(f)
+		f.Close()
+		return nil, fmt.Errorf("%s is locked by pid %s: %s",
+			path, strings.TrimSpace(string(data)), err)
+	}
+	f.Truncate(0)
+	f.WriteString(fmt.Sprintf("%d\n", os.Getpid()))
+	return &LockFile{f}, nil
+}
+
+// файл не удаляется: иначе другой процесс, уже открывший старый файл,
+// захватит его одновременно с третьим, создавшим новый
+func (l *LockFile) Unlock() {
+	l.f.Truncate(0)
+	unlockFile(l.f)
+	l.f.Close()
+}
+
+var stopRequested int32
+
+// попросить долгие циклы (fetch, parse) остановиться в ближайшей
+// безопасной точке: после текущего снимка
+func RequestStop() {
+	atomic.StoreInt32(&stopRequested, 1)
+}
+
+func StopRequested() bool {
+	return atomic.LoadInt32(&stopRequested) != 0
+}
+
+// деньги везде в меди, целыми: 1g = 100s = 10000c
+
+// цена за штуку, округлённая до меди
+func PerUnit(total int64, quantity int64) int64 {
+	if quantity <= 0 {
+		return 0
+	}
+	return (total + quantity/2) / quantity
+}
+
+// "12g 34s 56c" для отчётов
+func FormatMoney(copper int64) string {
+	sign := ""
+	if copper < 0 {
+		sign, copper = "-", -copper
+	}
+	g, s, c := copper/10000, copper/100%100, copper%100
+	switch {
+	case g > 0:
+		return fmt.Sprintf("%s%dg %02ds %02dc", sign, g, s, c)
+	case s > 0:
+		return fmt.Sprintf("%s%ds %02dc", sign, s, c)
+	}
+	return fmt.Sprintf("%s%dc", sign, c)
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	l, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Lock(path); err == nil {
+		t.Fatal("second lock succeeded while the first is held")
+	}
+	l.Unlock()
+	if !CheckFile(path) {
+		t.Error("lock file removed on unlock")
+	}
+	l, err = Lock(path)
+	if err != nil {
+		t.Fatalf("relock after unlock: %s", err)
+	}
+	l.Unlock()
+}
+
+func TestPerUnit(t *testing.T) {
+	cases := []struct{ total, quantity, want int64 }{
+		{10, 3, 3},
+		{11, 2, 6}, // половина - вверх
+		{1, 3, 0},
+		{7, 1, 7},
+		{0, 5, 0},
+		{5, 0, 0},
+		{5, -1, 0},
+	}
+	for _, c := range cases {
+		if got := PerUnit(c.total, c.quantity); got != c.want {
+			t.Errorf("PerUnit(%d, %d) = %d, want %d", c.total, c.quantity, got, c.want)
+		}
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	cases := []struct {
+		copper int64
+		want   string
+	}{
+		{0, "0c"},
+		{99, "99c"},
+		{100, "1s 00c"},
+		{9999, "99s 99c"},
+		{10000, "1g 00s 00c"},
+		{123456, "12g 34s 56c"},
+		{-5, "-5c"},
+		{-150, "-1s 50c"},
+		{-10001, "-1g 00s 01c"},
+	}
+	for _, c := range cases {
+		if got := FormatMoney(c.copper); got != c.want {
+			t.Errorf("FormatMoney(%d) = %q, want %q", c.copper, got, c.want)
+		}
+	}
+}